@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	applyCmd = &cobra.Command{
+		Use:   "apply",
+		Short: "Installs or updates a package",
+		Long:  `Installs or updates a package together with all its dependencies`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requirePkg(); err != nil {
+				return err
+			}
+			pkgManager, err := newPackageManager()
+			if err != nil {
+				return err
+			}
+			constraints, err := semver.NewConstraint(version)
+			if err != nil {
+				return err
+			}
+			parameter, err := newParameter()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := newContext()
+			defer cancel()
+			target, err := newTarget(ctx)
+			if err != nil {
+				return err
+			}
+			installation, err := pkgManager.ApplyContext(ctx, target, pkg, constraints, parameter)
+			if err != nil {
+				return err
+			}
+			return printStatus(pkgManager, installation.Digest)
+		},
+	}
+)
+
+func init() {
+	addParameterFlags(applyCmd)
+	rootCmd.AddCommand(applyCmd)
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	deleteCmd = &cobra.Command{
+		Use:   "delete",
+		Short: "Deletes a package",
+		Long:  `Deletes a package together with all dependencies which aren't requested by other installations`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requirePkg(); err != nil {
+				return err
+			}
+			pkgManager, err := newPackageManager()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := newContext()
+			defer cancel()
+			target, err := newTarget(ctx)
+			if err != nil {
+				return err
+			}
+			return pkgManager.DeleteContext(ctx, target, pkg)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(deleteCmd)
+}
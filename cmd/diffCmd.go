@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffCmd = &cobra.Command{
+		Use:   "diff",
+		Short: "Shows the installations which drifted",
+		Long: `Compares all installations of the state with their targets. Helm releases, kapp apps, orgs, spaces
+and service brokers are checked.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkgManager, err := newPackageManager()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := newContext()
+			defer cancel()
+			report, err := pkgManager.DiffContext(ctx)
+			if err != nil {
+				return err
+			}
+			return printOutput(report, report.String)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	graphFormat string
+
+	graphCmd = &cobra.Command{
+		Use:   "graph",
+		Short: "Exports the dependency graph",
+		Long:  `Exports the dependency graph of all installations as Graphviz DOT or Mermaid flowchart`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkgManager, err := newPackageManager()
+			if err != nil {
+				return err
+			}
+			graph := pkgManager.Graph()
+			switch graphFormat {
+			case "dot":
+				fmt.Print(graph.DOT())
+			case "mermaid":
+				fmt.Print(graph.Mermaid())
+			default:
+				return fmt.Errorf("unknown graph format %s", graphFormat)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	graphCmd.Flags().StringVarP(&graphFormat, "format", "f", "dot", "graph format (dot or mermaid)")
+	rootCmd.AddCommand(graphCmd)
+}
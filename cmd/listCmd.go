@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+var (
+	listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists all installations",
+		Long:  `Lists all installations with their version, target and requesters`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkgManager, err := newPackageManager()
+			if err != nil {
+				return err
+			}
+			nodes := pkgManager.Graph().Nodes
+			return printOutput(nodes, func() string {
+				return listText(nodes)
+			})
+		},
+	}
+)
+
+func listText(nodes []*landep.GraphNode) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tVERSION\tTARGET\tREQUESTERS")
+	for _, node := range nodes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", node.PkgName, node.Version, node.Target, strings.Join(node.Requesters, ", "))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+}
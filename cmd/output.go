@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// printOutput prints value in the format selected with --output. text renders the text format.
+func printOutput(value interface{}, text func() string) error {
+	switch output {
+	case "text":
+		fmt.Print(text())
+		return nil
+	case "json":
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	case "yaml":
+		// convert via JSON to respect the json tags and raw JSON parameters
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		err = json.Unmarshal(data, &generic)
+		if err != nil {
+			return err
+		}
+		data, err = yaml.Marshal(generic)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %s", output)
+	}
+}
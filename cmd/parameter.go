@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+var (
+	valuesFiles []string
+	setValues   []string
+)
+
+func addParameterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&valuesFiles, "values", "f", nil, "JSON or YAML file with parameters (can be repeated)")
+	cmd.Flags().StringArrayVar(&setValues, "set", nil, "parameter given as path=value, e.g. pilot.instances=3 (can be repeated)")
+}
+
+// newParameter merges the files given with --values and the values given with --set in this order.
+// Later values override earlier ones.
+func newParameter() (landep.Parameter, error) {
+	var parameters []json.RawMessage
+	for _, file := range valuesFiles {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		parameter, err := landep.YamlToJson(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid values file %s: %v", file, err)
+		}
+		if _, ok, _ := landep.JsonMappify(parameter); !ok {
+			return nil, fmt.Errorf("invalid values file %s: not an object", file)
+		}
+		parameters = append(parameters, parameter)
+	}
+	for _, set := range setValues {
+		parameter, err := setParameter(set)
+		if err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, parameter)
+	}
+	if len(parameters) == 0 {
+		return nil, nil
+	}
+	return landep.JsonMerge(parameters, landep.WithConflictSolver(landep.LastWinsConflictSolver))
+}
+
+// setParameter converts path=value into a JSON object. The path is separated by dots. The value is
+// taken as JSON if possible (e.g. numbers, booleans, quoted strings), otherwise as string.
+func setParameter(set string) (json.RawMessage, error) {
+	index := strings.Index(set, "=")
+	if index <= 0 {
+		return nil, fmt.Errorf("invalid value %q, expected path=value", set)
+	}
+	path := strings.Split(set[:index], ".")
+	value := json.RawMessage(set[index+1:])
+	if !json.Valid(value) {
+		var err error
+		value, err = json.Marshal(set[index+1:])
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == "" {
+			return nil, fmt.Errorf("invalid path %q in %q", set[:index], set)
+		}
+		data, err := json.Marshal(map[string]json.RawMessage{path[i]: value})
+		if err != nil {
+			return nil, err
+		}
+		value = data
+	}
+	return value, nil
+}
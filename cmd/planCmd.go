@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	planCmd = &cobra.Command{
+		Use:   "plan",
+		Short: "Shows what apply would do",
+		Long:  `Resolves the complete dependency graph of a package without modifying any target`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requirePkg(); err != nil {
+				return err
+			}
+			pkgManager, err := newPackageManager()
+			if err != nil {
+				return err
+			}
+			constraints, err := semver.NewConstraint(version)
+			if err != nil {
+				return err
+			}
+			parameter, err := newParameter()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := newContext()
+			defer cancel()
+			target, err := newTarget(ctx)
+			if err != nil {
+				return err
+			}
+			plan, err := pkgManager.PlanContext(ctx, target, pkg, constraints, parameter)
+			if err != nil {
+				return err
+			}
+			return printOutput(plan, plan.String)
+		},
+	}
+)
+
+func init() {
+	addParameterFlags(planCmd)
+	rootCmd.AddCommand(planCmd)
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	reconcileCmd = &cobra.Command{
+		Use:   "reconcile",
+		Short: "Reapplies the installations which drifted",
+		Long:  `Compares all installations of the state with their targets like diff and reapplies the drifted ones in dependency order`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkgManager, err := newPackageManager()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := newContext()
+			defer cancel()
+			report, err := pkgManager.ReconcileContext(ctx)
+			if err != nil {
+				return err
+			}
+			return printOutput(report, report.String)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(reconcileCmd)
+}
@@ -1,46 +1,147 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.tools.sap/D001323/landep/pkg/installer"
 
-	"github.com/Masterminds/semver/v3"
-
 	"github.com/spf13/cobra"
 	"github.tools.sap/D001323/landep/pkg/landep"
 )
 
 var (
 	// Used for flags.
-	pkg       string
-	version   string
-	namespace string
+	pkg                 string
+	version             string
+	targetsFile         string
+	targetName          string
+	stateFile           string
+	workers             int
+	timeout             time.Duration
+	installationTimeout time.Duration
+	maxAttempts         int
+	retryBackoff        time.Duration
+	secretsDir          string
+	secretsFile         string
+	output              string
+	fakeTargets         bool
+	progress            bool
+	kubectlBinary       string
+	helmBinary          string
+	helmRepository      string
+	kappBinary          string
+	yttBinary           string
+	kappSources         string
 
 	rootCmd = &cobra.Command{
-		Use:   "installer",
-		Short: "Installer",
-		Long:  `Installer`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			installer.Init()
-			landep.InitFakeTargetFactory(func(message string) {
-				fmt.Println(message)
-			})
-
-			constraints, err := semver.NewConstraint(version)
+		Use:          "installer",
+		Short:        "Installer",
+		Long:         `Installs packages and their dependencies into targets`,
+		SilenceUsage: true,
+	}
+)
+
+func newPackageManager() (*landep.PackageManager, error) {
+	installer.Init()
+	if fakeTargets {
+		// operations go to stderr to keep the output parseable
+		landep.InitFakeTargetFactory(func(message string) {
+			fmt.Fprintln(os.Stderr, message)
+		})
+	} else {
+		options := []landep.TargetFactoryOption{
+			landep.WithKubectlBinary(kubectlBinary),
+			landep.WithHelmBinary(helmBinary),
+			landep.WithHelmRepository(helmRepository),
+			landep.WithKappBinary(kappBinary),
+			landep.WithYttBinary(yttBinary),
+		}
+		if kappSources != "" {
+			sources, err := landep.LoadKappSources(kappSources)
 			if err != nil {
-				return err
+				return nil, err
 			}
+			options = append(options, landep.WithKappSources(sources))
+		}
+		err := landep.InitTargetFactory(options...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	options := []landep.PackageManagerOption{
+		landep.WithStateStore(landep.NewFileStateStore(stateFile)),
+		landep.WithWorkers(workers),
+		landep.WithInstallationTimeout(installationTimeout),
+		landep.WithRetryPolicy(landep.RetryPolicy{MaxAttempts: maxAttempts, InitialBackoff: retryBackoff, MaxBackoff: time.Minute, Multiplier: 2}),
+		landep.WithSecretResolver(newSecretResolver()),
+	}
+	if progress {
+		options = append(options, landep.WithObserver(landep.ObserverFunc(func(event landep.Event) {
+			fmt.Fprintln(os.Stderr, event.String())
+		})))
+	}
+	return landep.NewPackageManager(landep.Repository, options...)
+}
 
-			pkgManager := landep.NewPackageManager(landep.Repository)
-			k8sConfig := &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"}
-			target := landep.NewK8sTarget(namespace, k8sConfig)
+// newSecretResolver prefers secrets from --secrets-file and --secrets-dir over environment variables
+func newSecretResolver() landep.SecretResolver {
+	var resolver landep.ChainSecretResolver
+	if secretsFile != "" {
+		resolver = append(resolver, landep.NewFileSecretResolver(secretsFile))
+	}
+	if secretsDir != "" {
+		resolver = append(resolver, landep.NewDirectorySecretResolver(secretsDir))
+	}
+	return append(resolver, landep.EnvSecretResolver{})
+}
 
-			_, err = pkgManager.Apply(target, pkg, constraints, nil)
-			return err
-		},
+// newContext returns a context which is cancelled on interrupt or after the configured timeout
+func newContext() (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
 	}
-)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
+func requirePkg() error {
+	if pkg == "" {
+		return errors.New("missing package, use --pkg")
+	}
+	return nil
+}
+
+// newTarget builds the target selected with --target. newPackageManager must have been called before
+// to initialize the target factory.
+func newTarget(ctx context.Context) (landep.Target, error) {
+	if targetName == "" {
+		return nil, errors.New("missing target, use --target")
+	}
+	targets, err := landep.LoadTargetsFile(targetsFile)
+	if err != nil {
+		return nil, err
+	}
+	return targets.Target(ctx, targetName, newSecretResolver())
+}
 
 // Execute executes the root command.
 func Execute() error {
@@ -48,8 +149,25 @@ func Execute() error {
 }
 
 func init() {
-
 	rootCmd.PersistentFlags().StringVar(&pkg, "pkg", "", "package")
-	rootCmd.PersistentFlags().StringVar(&version, "version", ">=0.0", "version")
-	rootCmd.PersistentFlags().StringVar(&namespace, "namespace", "default", "namespace")
+	rootCmd.PersistentFlags().StringVarP(&output, "output", "o", "text", "output format (text, json or yaml)")
+	rootCmd.PersistentFlags().StringVar(&version, "version", ">=0.0", "version constraint of the package")
+	rootCmd.PersistentFlags().StringVar(&targetsFile, "targets", ".landep/targets.yaml", "JSON or YAML file defining the targets")
+	rootCmd.PersistentFlags().StringVarP(&targetName, "target", "t", "", "name of the target defined in the targets file")
+	rootCmd.PersistentFlags().StringVar(&stateFile, "state", ".landep/state.json", "file to persist the installations")
+	rootCmd.PersistentFlags().IntVar(&workers, "workers", 1, "number of installers executed in parallel")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "timeout of the whole operation")
+	rootCmd.PersistentFlags().DurationVar(&installationTimeout, "installation-timeout", 0, "timeout of each installer invocation")
+	rootCmd.PersistentFlags().IntVar(&maxAttempts, "max-attempts", 1, "maximum number of attempts of installer invocations failing with a retryable error")
+	rootCmd.PersistentFlags().DurationVar(&retryBackoff, "retry-backoff", time.Second, "delay before the first retry, doubled after each attempt")
+	rootCmd.PersistentFlags().StringVar(&secretsDir, "secrets-dir", "", "directory containing one file per secret")
+	rootCmd.PersistentFlags().BoolVar(&progress, "progress", false, "print the resolution, application and deletion of installations to stderr")
+	rootCmd.PersistentFlags().BoolVar(&fakeTargets, "fake-targets", false, "only print the operations instead of executing them against the targets")
+	rootCmd.PersistentFlags().StringVar(&kubectlBinary, "kubectl", "kubectl", "kubectl binary used to create and delete namespaces")
+	rootCmd.PersistentFlags().StringVar(&helmBinary, "helm", "helm", "helm binary")
+	rootCmd.PersistentFlags().StringVar(&helmRepository, "helm-repository", "", "repository (e.g. an oci:// URL) prefixed to the chart names")
+	rootCmd.PersistentFlags().StringVar(&kappBinary, "kapp", "kapp", "kapp binary")
+	rootCmd.PersistentFlags().StringVar(&yttBinary, "ytt", "ytt", "ytt binary used to render kapp sources")
+	rootCmd.PersistentFlags().StringVar(&kappSources, "kapp-sources", "", "JSON or YAML file mapping kapp applications to their source directories")
+	rootCmd.PersistentFlags().StringVar(&secretsFile, "secrets-file", "", "JSON or YAML file mapping secret names to values")
 }
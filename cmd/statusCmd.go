@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+var (
+	statusCmd = &cobra.Command{
+		Use:   "status <pkg>",
+		Short: "Shows the installations of a package",
+		Long: `Shows version, target, requests, merged parameters, responses and children of all installations of a package.
+With --target only the installation in the given target is shown.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkgManager, err := newPackageManager()
+			if err != nil {
+				return err
+			}
+			var target landep.Target
+			if targetName != "" {
+				ctx, cancel := newContext()
+				defer cancel()
+				target, err = newTarget(ctx)
+				if err != nil {
+					return err
+				}
+			}
+			all, err := pkgManager.States()
+			if err != nil {
+				return err
+			}
+			var states []*landep.InstallationState
+			for _, state := range all {
+				if state.PkgName != args[0] {
+					continue
+				}
+				if target != nil && state.Digest != landep.InstallationDigest(target, args[0]) {
+					continue
+				}
+				states = append(states, state)
+			}
+			if len(states) == 0 {
+				return fmt.Errorf("no installation of %s found", args[0])
+			}
+			return printOutput(states, func() string {
+				return statusText(all, states)
+			})
+		},
+	}
+)
+
+// printStatus prints the status of the installation with the given digest
+func printStatus(pkgManager *landep.PackageManager, digest string) error {
+	all, err := pkgManager.States()
+	if err != nil {
+		return err
+	}
+	for _, state := range all {
+		if state.Digest == digest {
+			states := []*landep.InstallationState{state}
+			return printOutput(states, func() string {
+				return statusText(all, states)
+			})
+		}
+	}
+	return errors.New("installation not found")
+}
+
+// statusText describes the given states, children are named by the package of their state in all
+func statusText(all []*landep.InstallationState, states []*landep.InstallationState) string {
+	pkgNames := make(map[string]string)
+	for _, state := range all {
+		pkgNames[state.Digest] = state.PkgName
+	}
+	var sb strings.Builder
+	for i, state := range states {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(fmt.Sprintf("Package:    %s\n", state.PkgName))
+		sb.WriteString(fmt.Sprintf("Version:    %s\n", state.Version))
+		sb.WriteString(fmt.Sprintf("Target:     %s\n", state.Target))
+		sb.WriteString(fmt.Sprintf("Digest:     %s\n", state.Digest))
+		sb.WriteString("Requests:\n")
+		requesters := make([]string, 0, len(state.Requests))
+		for requester := range state.Requests {
+			requesters = append(requesters, requester)
+		}
+		sort.Strings(requesters)
+		for _, requester := range requesters {
+			sb.WriteString(fmt.Sprintf("  %s: %s\n", requester, state.Requests[requester].Constraints))
+		}
+		if state.Parameter != nil {
+			sb.WriteString(fmt.Sprintf("Parameter:  %s\n", string(state.Parameter)))
+		}
+		if state.Response != nil {
+			sb.WriteString(fmt.Sprintf("Response:   %s\n", string(state.Response)))
+		}
+		if len(state.Children) > 0 {
+			sb.WriteString("Children:\n")
+			for _, child := range state.Children {
+				sb.WriteString(fmt.Sprintf("  %s: %s (stage %d)\n", child.Name, pkgNames[child.Digest], child.Stage))
+			}
+		}
+	}
+	return sb.String()
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
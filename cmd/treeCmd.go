@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	treeCmd = &cobra.Command{
+		Use:   "tree",
+		Short: "Shows the installations as tree",
+		Long:  `Shows the installations requested directly together with their (transitive) dependencies`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkgManager, err := newPackageManager()
+			if err != nil {
+				return err
+			}
+			tree := pkgManager.Graph().Tree()
+			return printOutput(tree, tree.String)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(treeCmd)
+}
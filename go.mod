@@ -8,4 +8,5 @@ require (
 	github.com/onsi/ginkgo v1.14.2
 	github.com/onsi/gomega v1.10.4
 	github.com/spf13/cobra v1.1.1
+	gopkg.in/yaml.v2 v2.3.0
 )
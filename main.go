@@ -1,7 +1,13 @@
 package main
 
-import "github.tools.sap/D001323/landep/cmd"
+import (
+	"os"
+
+	"github.tools.sap/D001323/landep/cmd"
+)
 
 func main() {
-	cmd.Execute()
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
@@ -1,6 +1,7 @@
 package installer
 
 import (
+	"context"
 	"errors"
 
 	"github.com/Masterminds/semver/v3"
@@ -27,7 +28,7 @@ func cloudFoundryInstallerFactory(target landep.Target, version *semver.Version)
 	return &cloudFoundryInstaller{k8sTarget: k8sTarget, version: version}, nil
 }
 
-func (s *cloudFoundryInstaller) Apply(name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+func (s *cloudFoundryInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
 	var params landep.Parameter
 	var istioResponse IstioResponse
 	return helper.
@@ -36,7 +37,7 @@ func (s *cloudFoundryInstaller) Apply(name string, images map[string]landep.Imag
 			landep.WithTarget(landep.NewK8sTarget("istio-system", s.k8sTarget.Config())),
 			landep.WithJsonParameter(&IstioParameter{Pilot: Pilot{Instances: 1}})).
 		Apply(func() (interface{}, error) {
-			err := s.k8sTarget.Kapp().Apply(name, "cf-for-k8s-scp", s.version, params)
+			err := s.k8sTarget.Kapp().Apply(ctx, name, "cf-for-k8s-scp", s.version, params)
 			if err != nil {
 				return nil, err
 			}
@@ -60,6 +61,6 @@ func (s *cloudFoundryInstaller) Apply(name string, images map[string]landep.Imag
 
 }
 
-func (s *cloudFoundryInstaller) Delete(name string) error {
-	return s.k8sTarget.Kapp().Delete(name)
+func (s *cloudFoundryInstaller) Delete(ctx context.Context, name string) error {
+	return s.k8sTarget.Kapp().Delete(ctx, name)
 }
@@ -1,6 +1,7 @@
 package installer
 
 import (
+	"context"
 	"errors"
 
 	"github.com/Masterminds/semver/v3"
@@ -25,7 +26,7 @@ func cloudFoundryEnvironmentInstallerFactory(target landep.Target, version *semv
 	return &cloudFoundryEnvironmentInstaller{k8sTarget: k8sTarget, version: version}, nil
 }
 
-func (s *cloudFoundryEnvironmentInstaller) Apply(name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+func (s *cloudFoundryEnvironmentInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
 	clusterResponse := ClusterResponse{}
 	cloudFoundryResponse := CloudFoundryResponse{}
 	var parameter landep.Parameter
@@ -43,6 +44,6 @@ func (s *cloudFoundryEnvironmentInstaller) Apply(name string, images map[string]
 	})
 }
 
-func (s *cloudFoundryEnvironmentInstaller) Delete(name string) error {
+func (s *cloudFoundryEnvironmentInstaller) Delete(ctx context.Context, name string) error {
 	return nil
 }
@@ -1,6 +1,7 @@
 package installer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -27,18 +28,18 @@ func clusterInstallerFactory(target landep.Target, version *semver.Version) (lan
 	return &clusterInstaller{k8sTarget: k8sTarget, version: version}, nil
 }
 
-func (s *clusterInstaller) Apply(name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+func (s *clusterInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
 	var params landep.Response
 	return helper.
 		MergedJsonParameter(&params).
 		Apply(func() (interface{}, error) {
 			return &ClusterResponse{
 				URL: fmt.Sprintf("https://%s.cluster.hana-ondemand.com", name),
-			}, s.k8sTarget.Helm().Apply(name, "cluster", s.version, params)
+			}, s.k8sTarget.Helm().Apply(ctx, name, "cluster", s.version, params)
 
 		})
 }
 
-func (s *clusterInstaller) Delete(name string) error {
-	return s.k8sTarget.Helm().Delete(name)
+func (s *clusterInstaller) Delete(ctx context.Context, name string) error {
+	return s.k8sTarget.Helm().Delete(ctx, name)
 }
@@ -0,0 +1,133 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+type blockingInstaller struct{}
+
+func (s *blockingInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s *blockingInstaller) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+// blockingRootInstaller requests all its dependencies at once
+type blockingRootInstaller struct {
+	dependencies []string
+}
+
+func (s *blockingRootInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	dummy := struct{}{}
+	for _, dependency := range s.dependencies {
+		helper.InstallationRequest(&dummy, dependency, dependency, ">= 1.0")
+	}
+	return helper.Apply(func() (interface{}, error) {
+		return &dummy, nil
+	})
+}
+
+func (s *blockingRootInstaller) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+type legacyInstaller struct {
+	recorder *testRecorder
+}
+
+func (s *legacyInstaller) Apply(name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	return helper.Apply(func() (interface{}, error) {
+		s.recorder.record("apply test.io/pkgs/legacy")
+		return &struct{}{}, nil
+	})
+}
+
+func (s *legacyInstaller) Delete(name string) error {
+	s.recorder.record("delete test.io/pkgs/legacy")
+	return nil
+}
+
+var _ = Describe("contexts", func() {
+	recorder := &testRecorder{}
+	landep.Repository.Register("test.io/pkgs/blocking", semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+		return &blockingInstaller{}, nil
+	})
+	landep.Repository.Register("test.io/pkgs/blocking-root", semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+		return &blockingRootInstaller{dependencies: []string{"test.io/pkgs/blocking"}}, nil
+	})
+	for _, pkgName := range []string{"test.io/pkgs/blocking-a", "test.io/pkgs/blocking-b", "test.io/pkgs/blocking-c"} {
+		landep.Repository.Register(pkgName, semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+			return &blockingInstaller{}, nil
+		})
+	}
+	landep.Repository.Register("test.io/pkgs/blocking-siblings", semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+		return &blockingRootInstaller{dependencies: []string{"test.io/pkgs/blocking-a", "test.io/pkgs/blocking-b", "test.io/pkgs/blocking-c"}}, nil
+	})
+	landep.Repository.Register("test.io/pkgs/legacy", semver.MustParse("1.0.0"), landep.AdaptLegacyInstallerFactory(func(target landep.Target, version *semver.Version) (landep.LegacyInstaller, error) {
+		return &legacyInstaller{recorder: recorder}, nil
+	}))
+
+	k8sConfig := &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"}
+	constraint, _ := semver.NewConstraint(">= 1.0")
+
+	It("interrupts installations exceeding the installation timeout", func() {
+		target := landep.NewK8sTarget("context", k8sConfig)
+		pkgManager, err := landep.NewPackageManager(landep.Repository, landep.WithInstallationTimeout(10*time.Millisecond))
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "test.io/pkgs/blocking-root", constraint, nil)
+		var interrupted *landep.Interrupted
+		Expect(errors.As(err, &interrupted)).To(BeTrue())
+		Expect(interrupted.PkgName).To(Equal("test.io/pkgs/blocking"))
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		Expect(recorder.reset()).To(BeEmpty())
+	})
+
+	It("stops resolving dependencies if the context is cancelled", func() {
+		target := landep.NewK8sTarget("context", k8sConfig)
+		pkgManager, err := landep.NewPackageManager(landep.Repository)
+		Expect(err).To(Succeed())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = pkgManager.ApplyContext(ctx, target, "test.io/pkgs/blocking-root", constraint, nil)
+		var interrupted *landep.Interrupted
+		Expect(errors.As(err, &interrupted)).To(BeTrue())
+		Expect(interrupted.PkgName).To(Equal("test.io/pkgs/blocking-root"))
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+	})
+
+	It("interrupts dependencies waiting for a worker", func() {
+		target := landep.NewK8sTarget("context-workers", k8sConfig)
+		pkgManager, err := landep.NewPackageManager(landep.Repository, landep.WithWorkers(2))
+		Expect(err).To(Succeed())
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = pkgManager.ApplyContext(ctx, target, "test.io/pkgs/blocking-siblings", constraint, nil)
+		var interrupted *landep.Interrupted
+		Expect(errors.As(err, &interrupted)).To(BeTrue())
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		states, err := pkgManager.States()
+		Expect(err).To(Succeed())
+		Expect(states).To(BeEmpty())
+	})
+
+	It("adapts legacy installers", func() {
+		target := landep.NewK8sTarget("context", k8sConfig)
+		pkgManager, err := landep.NewPackageManager(landep.Repository)
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "test.io/pkgs/legacy", constraint, nil)
+		Expect(err).To(Succeed())
+		err = pkgManager.Delete(target, "test.io/pkgs/legacy")
+		Expect(err).To(Succeed())
+		Expect(recorder.reset()).To(Equal([]string{"apply test.io/pkgs/legacy", "delete test.io/pkgs/legacy"}))
+	})
+})
@@ -0,0 +1,105 @@
+package installer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+// cyclicInstaller requests all its dependencies at once. If started is set, the dependencies are requested
+// as soon as all installers sharing started were applied once.
+type cyclicInstaller struct {
+	dependencies []string
+	started      *sync.WaitGroup
+	once         *sync.Once
+}
+
+func (s *cyclicInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	if s.started != nil {
+		s.once.Do(s.started.Done)
+		s.started.Wait()
+	}
+	dummy := struct{}{}
+	for _, dependency := range s.dependencies {
+		helper.InstallationRequest(&dummy, dependency, dependency, ">= 1.0")
+	}
+	return helper.Apply(func() (interface{}, error) {
+		return &dummy, nil
+	})
+}
+
+func (s *cyclicInstaller) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+func cyclicInstallerFactory(dependencies ...string) landep.InstallerFactory {
+	return func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+		return &cyclicInstaller{dependencies: dependencies}, nil
+	}
+}
+
+var _ = Describe("dependency cycles", func() {
+	landep.Repository.Register("test.io/pkgs/cycle-a", semver.MustParse("1.0.0"), cyclicInstallerFactory("test.io/pkgs/cycle-b"))
+	landep.Repository.Register("test.io/pkgs/cycle-b", semver.MustParse("1.0.0"), cyclicInstallerFactory("test.io/pkgs/cycle-c"))
+	landep.Repository.Register("test.io/pkgs/cycle-c", semver.MustParse("1.0.0"), cyclicInstallerFactory("test.io/pkgs/cycle-a"))
+	landep.Repository.Register("test.io/pkgs/parallel-cycle-a", semver.MustParse("1.0.0"), cyclicInstallerFactory("test.io/pkgs/parallel-cycle-b", "test.io/pkgs/parallel-cycle-c"))
+	// b and c are locked by their installations before they request each other
+	started := &sync.WaitGroup{}
+	started.Add(2)
+	startedFactory := func(dependency string) landep.InstallerFactory {
+		once := &sync.Once{}
+		return func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+			return &cyclicInstaller{dependencies: []string{dependency}, started: started, once: once}, nil
+		}
+	}
+	landep.Repository.Register("test.io/pkgs/parallel-cycle-b", semver.MustParse("1.0.0"), startedFactory("test.io/pkgs/parallel-cycle-c"))
+	landep.Repository.Register("test.io/pkgs/parallel-cycle-c", semver.MustParse("1.0.0"), startedFactory("test.io/pkgs/parallel-cycle-b"))
+
+	It("aborts with the cycle path", func() {
+		pkgManager, err := landep.NewPackageManager(landep.Repository)
+		Expect(err).To(Succeed())
+		target := landep.NewK8sTarget("cycle", &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"})
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "test.io/pkgs/cycle-a", constraint, nil)
+		Expect(err).To(HaveOccurred())
+		cycle, ok := err.(*landep.DependencyCycle)
+		Expect(ok).To(BeTrue())
+		Expect(cycle.Chain).To(HaveLen(4))
+		Expect(cycle.Chain[0].PkgName).To(Equal("test.io/pkgs/cycle-a"))
+		Expect(cycle.Chain[0].Requester).To(Equal("package-manager"))
+		Expect(cycle.Chain[1].PkgName).To(Equal("test.io/pkgs/cycle-b"))
+		Expect(cycle.Chain[2].PkgName).To(Equal("test.io/pkgs/cycle-c"))
+		Expect(cycle.Chain[3].PkgName).To(Equal("test.io/pkgs/cycle-a"))
+		Expect(cycle.Chain[3].Requester).To(MatchRegexp(`test.io/pkgs/cycle-c/\w+`))
+		Expect(err.Error()).To(ContainSubstring("test.io/pkgs/cycle-a on k8s(https://gardener.canary.hana-ondemand.com, namespace cycle)"))
+	})
+
+	It("aborts cycles between dependencies applied in parallel", func() {
+		pkgManager, err := landep.NewPackageManager(landep.Repository, landep.WithWorkers(4))
+		Expect(err).To(Succeed())
+		target := landep.NewK8sTarget("parallel-cycle", &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"})
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		errs := make(chan error, 1)
+		go func() {
+			_, err := pkgManager.Apply(target, "test.io/pkgs/parallel-cycle-a", constraint, nil)
+			errs <- err
+		}()
+		Eventually(errs, 5*time.Second).Should(Receive(&err))
+		cycle, ok := err.(*landep.DependencyCycle)
+		Expect(ok).To(BeTrue(), "%v", err)
+		Expect(cycle.Chain).To(HaveLen(3))
+		Expect(cycle.Chain[0].PkgName).To(Equal(cycle.Chain[2].PkgName))
+		Expect(cycle.Chain[0].PkgName).To(Or(Equal("test.io/pkgs/parallel-cycle-b"), Equal("test.io/pkgs/parallel-cycle-c")))
+		Expect(cycle.Chain[0].Requester).To(MatchRegexp(`test.io/pkgs/parallel-cycle-a/\w+`))
+		states, err := pkgManager.States()
+		Expect(err).To(Succeed())
+		Expect(states).To(BeEmpty())
+	})
+})
@@ -0,0 +1,114 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+var _ = Describe("drift detection", func() {
+	ctx := context.Background()
+	k8sConfig := &landep.K8sConfig{URL: "https://drift.example.com"}
+	var pkgManager *landep.PackageManager
+	var constraint *semver.Constraints
+
+	BeforeEach(func() {
+		var err error
+		pkgManager, err = landep.NewPackageManager(landep.Repository, testSecrets)
+		Expect(err).To(Succeed())
+		constraint, err = semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+	})
+
+	differences := func(report *landep.DriftReport) map[string][]string {
+		result := map[string][]string{}
+		for _, installation := range report.Drifted() {
+			result[installation.PkgName] = installation.Differences
+		}
+		return result
+	}
+
+	It("reports and reconciles drifted helm releases and kapp apps", func() {
+		target := landep.NewK8sTarget("cf-system", k8sConfig)
+		istioTarget := landep.NewK8sTarget("istio-system", k8sConfig)
+		cf := landep.InstallationDigest(target, "docker.io/pkgs/cloud-foundry")
+		istio := landep.InstallationDigest(istioTarget, "docker.io/pkgs/istio")
+		_, err := pkgManager.Apply(target, "docker.io/pkgs/cloud-foundry", constraint, nil)
+		Expect(err).To(Succeed())
+		defer pkgManager.Delete(target, "docker.io/pkgs/cloud-foundry")
+
+		report, err := pkgManager.Diff()
+		Expect(err).To(Succeed())
+		Expect(report.Installations).To(HaveLen(2))
+		Expect(report.Installations[0].PkgName).To(Equal("docker.io/pkgs/istio"))
+		Expect(report.Drifted()).To(BeEmpty())
+
+		Expect(istioTarget.Helm().Apply(ctx, istio, "istio", semver.MustParse("1.7.0"), []byte(`{"pilot":{"instances":3}}`))).To(Succeed())
+		Expect(target.Kapp().Delete(ctx, cf)).To(Succeed())
+		report, err = pkgManager.Diff()
+		Expect(err).To(Succeed())
+		Expect(differences(report)).To(Equal(map[string][]string{
+			"docker.io/pkgs/istio":         {"values of helm release " + istio + ` differ: {"pilot":{"instances":3}} instead of {"pilot":{"instances":1}}`},
+			"docker.io/pkgs/cloud-foundry": {"kapp app " + cf + " is missing"},
+		}))
+
+		report, err = pkgManager.Reconcile()
+		Expect(err).To(Succeed())
+		Expect(report.Installations[0].Reconciled).To(BeTrue())
+		Expect(report.Installations[1].Reconciled).To(BeTrue())
+		status, err := istioTarget.Helm().Status(ctx, istio)
+		Expect(err).To(Succeed())
+		Expect(status.Revision).To(Equal(3))
+		values, err := istioTarget.Helm().GetValues(ctx, istio)
+		Expect(err).To(Succeed())
+		Expect(values).To(MatchJSON(`{"pilot":{"instances":1}}`))
+		_, err = target.Kapp().Status(ctx, cf)
+		Expect(err).To(Succeed())
+
+		report, err = pkgManager.Diff()
+		Expect(err).To(Succeed())
+		Expect(report.Drifted()).To(BeEmpty())
+	})
+
+	It("reports missing orgs and spaces", func() {
+		target := landep.NewCloudFoundryTarget(&landep.CloudFoundryConfig{CloudFoundryCredentials: landep.Credentials{URL: "https://api.drift.example.com"}})
+		org := landep.InstallationDigest(target, "docker.io/pkgs/organization")
+		space := landep.InstallationDigest(target, "docker.io/pkgs/space")
+		_, err := pkgManager.Apply(target, "docker.io/pkgs/space", constraint, mustParameter(&SpaceParameter{
+			Organization: &OrganizationParameter{Username: "admin"},
+		}))
+		Expect(err).To(Succeed())
+		defer pkgManager.Delete(target, "docker.io/pkgs/space")
+
+		Expect(target.DeleteOrg(ctx, org)).To(Succeed())
+		report, err := pkgManager.Diff()
+		Expect(err).To(Succeed())
+		Expect(differences(report)).To(Equal(map[string][]string{
+			"docker.io/pkgs/organization": {"organization " + org + " is missing"},
+			"docker.io/pkgs/space":        {"space " + space + " is missing in organization " + org},
+		}))
+		Expect(report.String()).To(Equal("1. docker.io/pkgs/organization 1.0.0 on " + target.Description().String() + " drifted\n" +
+			"   organization " + org + " is missing\n" +
+			"2. docker.io/pkgs/space 1.0.0 on " + target.Description().String() + " drifted\n" +
+			"   space " + space + " is missing in organization " + org + "\n"))
+		description, err := json.Marshal(target.Description())
+		Expect(err).To(Succeed())
+		data, err := json.Marshal(report.Installations[0])
+		Expect(err).To(Succeed())
+		Expect(data).To(MatchJSON(`{"digest":"` + org + `","pkgName":"docker.io/pkgs/organization","version":"1.0.0","target":` + string(description) + `,"differences":["organization ` + org + ` is missing"]}`))
+
+		report, err = pkgManager.Reconcile()
+		Expect(err).To(Succeed())
+		Expect(report.String()).To(ContainSubstring("2. docker.io/pkgs/space 1.0.0 on " + target.Description().String() + " reconciled\n"))
+		exists, err := target.SpaceExists(ctx, org, space)
+		Expect(err).To(Succeed())
+		Expect(exists).To(BeTrue())
+		report, err = pkgManager.Diff()
+		Expect(err).To(Succeed())
+		Expect(report.Drifted()).To(BeEmpty())
+	})
+})
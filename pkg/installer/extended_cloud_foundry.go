@@ -1,6 +1,7 @@
 package installer
 
 import (
+	"context"
 	"errors"
 
 	"github.com/Masterminds/semver/v3"
@@ -25,7 +26,7 @@ func extendedCloudFoundryEnvironmentInstallerFactory(target landep.Target, versi
 	return &extendedCloudFoundryEnvironmentInstaller{k8sTarget: k8sTarget, version: version}, nil
 }
 
-func (s *extendedCloudFoundryEnvironmentInstaller) Apply(name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+func (s *extendedCloudFoundryEnvironmentInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
 	cloudFoundryResponse := CloudFoundryResponse{}
 	var parameter landep.Parameter
 	dummy := struct{}{}
@@ -48,6 +49,6 @@ func (s *extendedCloudFoundryEnvironmentInstaller) Apply(name string, images map
 	})
 }
 
-func (s *extendedCloudFoundryEnvironmentInstaller) Delete(name string) error {
+func (s *extendedCloudFoundryEnvironmentInstaller) Delete(ctx context.Context, name string) error {
 	return nil
 }
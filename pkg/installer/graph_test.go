@@ -0,0 +1,88 @@
+package installer
+
+import (
+	"context"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+// graphInstaller requests test.io/pkgs/graph-shared as dependency with the given name, if any
+type graphInstaller struct {
+	dependency string
+}
+
+func (s *graphInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	dummy := struct{}{}
+	if s.dependency != "" {
+		helper.InstallationRequest(&dummy, s.dependency, "test.io/pkgs/graph-shared", ">= 1.0")
+	}
+	return helper.Apply(func() (interface{}, error) {
+		return &dummy, nil
+	})
+}
+
+func (s *graphInstaller) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+func graphInstallerFactory(dependency string) landep.InstallerFactory {
+	return func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+		return &graphInstaller{dependency: dependency}, nil
+	}
+}
+
+var _ = Describe("graph", func() {
+	landep.Repository.Register("test.io/pkgs/graph-shared", semver.MustParse("1.0.0"), graphInstallerFactory(""))
+	landep.Repository.Register("test.io/pkgs/graph-a", semver.MustParse("1.0.0"), graphInstallerFactory("db"))
+	landep.Repository.Register("test.io/pkgs/graph-b", semver.MustParse("2.0.0"), graphInstallerFactory("database"))
+
+	It("exports shared installations with all requesters", func() {
+		pkgManager, err := landep.NewPackageManager(landep.Repository)
+		Expect(err).To(Succeed())
+		target := landep.NewK8sTarget("graph", &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"})
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		a, err := pkgManager.Apply(target, "test.io/pkgs/graph-a", constraint, nil)
+		Expect(err).To(Succeed())
+		b, err := pkgManager.Apply(target, "test.io/pkgs/graph-b", constraint, nil)
+		Expect(err).To(Succeed())
+		shared := a.Children[0].Installation
+
+		graph := pkgManager.Graph()
+		Expect(graph.Nodes).To(HaveLen(3))
+		Expect(graph.Nodes[2].PkgName).To(Equal("test.io/pkgs/graph-shared"))
+		Expect(graph.Nodes[2].Shared()).To(BeTrue())
+		Expect(graph.Nodes[2].Requesters).To(Equal([]string{"test.io/pkgs/graph-a", "test.io/pkgs/graph-b"}))
+		Expect(graph.Nodes[0].Requesters).To(Equal([]string{"package-manager"}))
+		Expect(graph.Edges).To(ConsistOf(
+			&landep.GraphEdge{From: a.Digest, To: shared.Digest, Name: "db"},
+			&landep.GraphEdge{From: b.Digest, To: shared.Digest, Name: "database"}))
+
+		dot := graph.DOT()
+		Expect(dot).To(HavePrefix("digraph landep {\n"))
+		Expect(dot).To(ContainSubstring(`"` + a.Digest + `" [label="test.io/pkgs/graph-a\n1.0.0\nk8s(https://gardener.canary.hana-ondemand.com, namespace graph)"];`))
+		Expect(dot).To(ContainSubstring(`\nshared by test.io/pkgs/graph-a, test.io/pkgs/graph-b", style="bold,filled", fillcolor=lightyellow];`))
+		Expect(dot).To(ContainSubstring(`"` + b.Digest + `" -> "` + shared.Digest + `" [label="database"];`))
+
+		mermaid := graph.Mermaid()
+		Expect(mermaid).To(HavePrefix("flowchart TD\n"))
+		Expect(mermaid).To(ContainSubstring(`n` + a.Digest + ` -->|"db"| n` + shared.Digest))
+		Expect(mermaid).To(ContainSubstring(`<br/>shared by test.io/pkgs/graph-a, test.io/pkgs/graph-b"]`))
+		Expect(mermaid).To(ContainSubstring("class n" + shared.Digest + " shared\n"))
+
+		tree := graph.Tree()
+		Expect(tree).To(HaveLen(2))
+		Expect(tree[0].PkgName).To(Equal("test.io/pkgs/graph-a"))
+		Expect(tree[0].Children).To(HaveLen(1))
+		Expect(tree[0].Children[0].Name).To(Equal("db"))
+		Expect(tree[0].Children[0].Shared).To(BeTrue())
+		Expect(tree.String()).To(Equal(
+			"test.io/pkgs/graph-a 1.0.0 k8s(https://gardener.canary.hana-ondemand.com, namespace graph)\n" +
+				"└── db: test.io/pkgs/graph-shared 1.0.0 k8s(https://gardener.canary.hana-ondemand.com, namespace graph) (shared)\n" +
+				"test.io/pkgs/graph-b 2.0.0 k8s(https://gardener.canary.hana-ondemand.com, namespace graph)\n" +
+				"└── database: test.io/pkgs/graph-shared 1.0.0 k8s(https://gardener.canary.hana-ondemand.com, namespace graph) (shared)\n"))
+	})
+})
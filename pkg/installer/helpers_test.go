@@ -0,0 +1,46 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+// testRecorder records the applications and deletions of test installers
+type testRecorder struct {
+	mutex   sync.Mutex
+	records []string
+}
+
+func (s *testRecorder) record(format string, args ...interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records = append(s.records, fmt.Sprintf(format, args...))
+}
+
+func (s *testRecorder) reset() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	records := s.records
+	s.records = nil
+	return records
+}
+
+func mustParameter(parameter interface{}) landep.Parameter {
+	result, err := json.Marshal(parameter)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// testSecrets provides the secrets requested by the installers of this package
+var testSecrets = landep.WithSecretResolver(landep.SecretResolverFunc(func(ctx context.Context, name string) (landep.Secret, error) {
+	if name == "ARTIFACTORY" {
+		return landep.Secret(`{"auths":{}}`), nil
+	}
+	return nil, &landep.SecretNotFound{Name: name, Source: "test"}
+}))
@@ -1,6 +1,15 @@
 package installer
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
 	"github.com/Masterminds/semver/v3"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -9,14 +18,23 @@ import (
 
 var _ = Describe("landep", func() {
 	var logs []string
+	var logsMutex sync.Mutex
 	log := func(message string) {
+		logsMutex.Lock()
+		defer logsMutex.Unlock()
 		logs = append(logs, message)
 	}
 	landep.InitFakeTargetFactory(log)
 
-	pkgManager := landep.NewPackageManager(landep.Repository)
+	var pkgManager *landep.PackageManager
 	k8sConfig := &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"}
 
+	BeforeEach(func() {
+		var err error
+		pkgManager, err = landep.NewPackageManager(landep.Repository, testSecrets)
+		Expect(err).To(Succeed())
+	})
+
 	It("works with cluster-pkg installer", func() {
 		target := landep.NewK8sTarget("default", k8sConfig)
 		constraint, err := semver.NewConstraint(">= 1.0")
@@ -37,6 +55,53 @@ var _ = Describe("landep", func() {
 			Expect(logs[0]).To(ContainSubstring("helm delete"))
 		})
 	})
+	It("keeps shared namespaces", func() {
+		target := landep.NewK8sTarget("shared", &landep.K8sConfig{URL: k8sConfig.URL, KeepNamespaces: []string{"shared"}})
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		logs = nil
+		_, err = pkgManager.Apply(target, "docker.io/pkgs/cluster", constraint, nil)
+		Expect(err).To(Succeed())
+		Expect(logs).To(HaveLen(2))
+		Expect(logs[0]).To(MatchRegexp("kubectl create namespace shared -l landep.io/installation=\\w*"))
+		logs = nil
+		Expect(pkgManager.Delete(target, "docker.io/pkgs/cluster")).To(Succeed())
+		Expect(logs).To(ConsistOf(MatchRegexp("helm delete -n shared \\w*")))
+	})
+	It("deploys plain manifests and prunes removed objects", func() {
+		target := landep.NewK8sTarget("manifests", k8sConfig)
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		name := landep.InstallationDigest(target, "docker.io/pkgs/manifests")
+		configMap := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"
+		secret := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: credentials\n"
+		By("applies", func() {
+			logs = nil
+			_, err = pkgManager.Apply(target, "docker.io/pkgs/manifests", constraint, mustParameter(&ManifestsParameter{Manifests: configMap + "---\n" + secret}))
+			Expect(err).To(Succeed())
+			Expect(logs).To(Equal([]string{
+				"kubectl create namespace manifests -l landep.io/installation=" + name,
+				"kubectl apply -n manifests -l landep.io/installation=" + name + " ConfigMap/config Secret/credentials",
+			}))
+		})
+		By("prunes", func() {
+			logs = nil
+			_, err = pkgManager.Apply(target, "docker.io/pkgs/manifests", constraint, mustParameter(&ManifestsParameter{Manifests: configMap}))
+			Expect(err).To(Succeed())
+			Expect(logs).To(Equal([]string{
+				"kubectl apply -n manifests -l landep.io/installation=" + name + " ConfigMap/config",
+				"kubectl delete -n manifests Secret/credentials",
+			}))
+		})
+		By("deletes", func() {
+			logs = nil
+			Expect(pkgManager.Delete(target, "docker.io/pkgs/manifests")).To(Succeed())
+			Expect(logs).To(Equal([]string{
+				"kubectl delete -n manifests -l landep.io/installation=" + name,
+				"kubectl delete namespace manifests",
+			}))
+		})
+	})
 	It("works with dependencies", func() {
 		target := landep.NewK8sTarget("default", k8sConfig)
 		constraint, err := semver.NewConstraint(">= 1.0")
@@ -46,24 +111,34 @@ var _ = Describe("landep", func() {
 			parameter := landep.Parameter(nil)
 			_, err = pkgManager.Apply(target, "docker.io/pkgs/cloud-foundry-environment", constraint, parameter)
 			Expect(err).To(Succeed())
-			Expect(logs).To(HaveLen(5))
+			Expect(logs).To(HaveLen(8))
+			// the default namespace exists already
 			Expect(logs[0]).To(MatchRegexp("helm upgrade -i -n default --version 1.0.1 \\w* cluster"))
-			Expect(logs[1]).To(MatchRegexp("helm upgrade -i -n istio-system --version 1.7.0 \\w* istio"))
-			Expect(logs[2]).To(MatchRegexp("kapp deploy -n cf-system -a \\w* cf-for-k8s-scp"))
-			Expect(logs[3]).To(MatchRegexp("(helm upgrade -i -n service-agent-manager --version 0.1.0 \\w* service-manager-agent|cf create org \\w*)"))
-			Expect(logs[4]).To(MatchRegexp("(helm upgrade -i -n service-agent-manager --version 0.1.0 \\w* service-manager-agent|cf create org \\w*)"))
+			Expect(logs[1]).To(MatchRegexp("kubectl create namespace istio-system -l landep.io/installation=\\w*"))
+			Expect(logs[2]).To(MatchRegexp("helm upgrade -i -n istio-system --version 1.7.0 \\w* istio"))
+			Expect(logs[3]).To(MatchRegexp("kubectl create namespace cf-system -l landep.io/installation=\\w*"))
+			Expect(logs[4]).To(MatchRegexp("kapp deploy -n cf-system -a \\w* cf-for-k8s-scp"))
+			Expect(logs[5:]).To(ConsistOf(
+				MatchRegexp("kubectl create namespace service-agent-manager -l landep.io/installation=\\w*"),
+				MatchRegexp("helm upgrade -i -n service-agent-manager --version 0.1.0 \\w* service-manager-agent"),
+				MatchRegexp("cf create org \\w*")))
 		})
 		By("deletes", func() {
 			logs = nil
 			err = pkgManager.Delete(target, "docker.io/pkgs/cloud-foundry-environment")
 			Expect(err).To(Succeed())
-			Expect(logs).To(HaveLen(5))
-			// Sequence for the first 2 iterms is not defined because they don't depend on each other
-			Expect(logs[0]).To(MatchRegexp("(helm delete -n service-agent-manager|cf delete org) \\w*"))
-			Expect(logs[1]).To(MatchRegexp("(helm delete -n service-agent-manager|cf delete org) \\w*"))
-			Expect(logs[2]).To(MatchRegexp("kapp delete -n cf-system -a \\w*"))
-			Expect(logs[3]).To(MatchRegexp("helm delete -n istio-system \\w*"))
-			Expect(logs[4]).To(MatchRegexp("helm delete -n default \\w*"))
+			Expect(logs).To(HaveLen(8))
+			// Sequence for the first 3 iterms is not defined because they don't depend on each other
+			Expect(logs[:3]).To(ConsistOf(
+				MatchRegexp("helm delete -n service-agent-manager \\w*"),
+				"kubectl delete namespace service-agent-manager",
+				MatchRegexp("cf delete org \\w*")))
+			Expect(logs[3]).To(MatchRegexp("kapp delete -n cf-system -a \\w*"))
+			Expect(logs[4]).To(MatchRegexp("helm delete -n istio-system \\w*"))
+			Expect(logs[5]).To(Equal("kubectl delete namespace istio-system"))
+			// namespaces are deleted after the dependencies of their last installation
+			Expect(logs[6]).To(Equal("kubectl delete namespace cf-system"))
+			Expect(logs[7]).To(MatchRegexp("helm delete -n default \\w*"))
 		})
 
 	})
@@ -76,9 +151,11 @@ var _ = Describe("landep", func() {
 			parameter := landep.Parameter(nil)
 			_, err = pkgManager.Apply(target, "docker.io/pkgs/cloud-foundry", constraint, parameter)
 			Expect(err).To(Succeed())
-			Expect(logs).To(HaveLen(2))
-			Expect(logs[0]).To(MatchRegexp(`helm upgrade -i -n istio-system --version 1.7.0 \w* istio \{"pilot":\{"instances":1\}\}`))
-			Expect(logs[1]).To(MatchRegexp("kapp deploy -n cf-system -a \\w* cf-for-k8s-scp"))
+			Expect(logs).To(HaveLen(4))
+			Expect(logs[0]).To(MatchRegexp("kubectl create namespace istio-system -l landep.io/installation=\\w*"))
+			Expect(logs[1]).To(MatchRegexp(`helm upgrade -i -n istio-system --version 1.7.0 \w* istio \{"pilot":\{"instances":1\}\}`))
+			Expect(logs[2]).To(MatchRegexp("kubectl create namespace cf-system -l landep.io/installation=\\w*"))
+			Expect(logs[3]).To(MatchRegexp("kapp deploy -n cf-system -a \\w* cf-for-k8s-scp"))
 		})
 		By("apply kyma", func() {
 			target := landep.NewK8sTarget("kyma-system", k8sConfig)
@@ -86,27 +163,380 @@ var _ = Describe("landep", func() {
 			parameter := landep.Parameter(nil)
 			_, err = pkgManager.Apply(target, "docker.io/pkgs/kyma", constraint, parameter)
 			Expect(err).To(Succeed())
-			Expect(logs).To(HaveLen(2))
+			Expect(logs).To(HaveLen(3))
 			// Also update istio because of potential different parameters
 			Expect(logs[0]).To(MatchRegexp(`helm upgrade -i -n istio-system --version 1.7.0 \w* istio \{"pilot":\{"instances":3\}\}`))
-			Expect(logs[1]).To(MatchRegexp("helm upgrade -i -n kyma-system --version 1.17.0 \\w* kyma"))
+			Expect(logs[1]).To(MatchRegexp("kubectl create namespace kyma-system -l landep.io/installation=\\w*"))
+			Expect(logs[2]).To(MatchRegexp("helm upgrade -i -n kyma-system --version 1.17.0 \\w* kyma"))
 		})
 		By("deletes cloud-foundry and istio", func() {
 			logs = nil
 			err = pkgManager.Delete(target, "docker.io/pkgs/cloud-foundry")
 			Expect(err).To(Succeed())
-			Expect(logs).To(HaveLen(1))
+			Expect(logs).To(HaveLen(2))
 			Expect(logs[0]).To(MatchRegexp("kapp delete -n cf-system -a \\w*"))
+			Expect(logs[1]).To(Equal("kubectl delete namespace cf-system"))
 		})
 		By("deletes kyma and istio", func() {
 			logs = nil
 			target := landep.NewK8sTarget("kyma-system", k8sConfig)
 			err = pkgManager.Delete(target, "docker.io/pkgs/kyma")
 			Expect(err).To(Succeed())
-			Expect(logs).To(HaveLen(2))
+			Expect(logs).To(HaveLen(4))
 			Expect(logs[0]).To(MatchRegexp("helm delete -n kyma-system \\w*"))
 			Expect(logs[1]).To(MatchRegexp("helm delete -n istio-system \\w*"))
+			Expect(logs[2]).To(Equal("kubectl delete namespace istio-system"))
+			Expect(logs[3]).To(Equal("kubectl delete namespace kyma-system"))
 		})
 
 	})
+	It("persists installations across package managers", func() {
+		dir, err := ioutil.TempDir("", "landep")
+		Expect(err).To(Succeed())
+		defer os.RemoveAll(dir)
+		stateStore := landep.NewFileStateStore(filepath.Join(dir, "state.json"))
+		target := landep.NewK8sTarget("persisted", k8sConfig)
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		By("applies", func() {
+			logs = nil
+			pkgManager, err := landep.NewPackageManager(landep.Repository, landep.WithStateStore(stateStore))
+			Expect(err).To(Succeed())
+			_, err = pkgManager.Apply(target, "docker.io/pkgs/cloud-foundry", constraint, nil)
+			Expect(err).To(Succeed())
+			Expect(logs).To(HaveLen(4))
+		})
+		By("doesn't reapply unchanged installations after reload", func() {
+			logs = nil
+			pkgManager, err := landep.NewPackageManager(landep.Repository, landep.WithStateStore(stateStore))
+			Expect(err).To(Succeed())
+			_, err = pkgManager.Apply(target, "docker.io/pkgs/cloud-foundry", constraint, nil)
+			Expect(err).To(Succeed())
+			Expect(logs).To(BeEmpty())
+		})
+		By("deletes after reload", func() {
+			logs = nil
+			pkgManager, err := landep.NewPackageManager(landep.Repository, landep.WithStateStore(stateStore))
+			Expect(err).To(Succeed())
+			err = pkgManager.Delete(target, "docker.io/pkgs/cloud-foundry")
+			Expect(err).To(Succeed())
+			Expect(logs).To(HaveLen(4))
+			Expect(logs[0]).To(MatchRegexp("kapp delete -n persisted -a \\w*"))
+			Expect(logs[1]).To(MatchRegexp("helm delete -n istio-system \\w*"))
+			Expect(logs[2:]).To(Equal([]string{"kubectl delete namespace istio-system", "kubectl delete namespace persisted"}))
+			states, err := stateStore.Load()
+			Expect(err).To(Succeed())
+			Expect(states).To(BeEmpty())
+		})
+	})
+	It("plans without side effects", func() {
+		target := landep.NewK8sTarget("planned", k8sConfig)
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		logs = nil
+		plan, err := pkgManager.Plan(target, "docker.io/pkgs/cloud-foundry", constraint, nil)
+		Expect(err).To(Succeed())
+		Expect(logs).To(BeEmpty())
+		Expect(plan.Steps).To(HaveLen(2))
+		Expect(plan.Steps[0].PkgName).To(Equal("docker.io/pkgs/istio"))
+		Expect(plan.Steps[0].Action).To(Equal(landep.PlanActionInstall))
+		Expect(plan.Steps[0].Version).To(Equal("1.7.0"))
+		Expect(string(plan.Steps[0].Parameter)).To(Equal(`{"pilot":{"instances":1}}`))
+		Expect(plan.Steps[0].Operations).To(ConsistOf(MatchRegexp(`helm upgrade -i -n istio-system --version 1.7.0 \w* istio`)))
+		Expect(plan.Steps[1].PkgName).To(Equal("docker.io/pkgs/cloud-foundry"))
+		Expect(plan.Steps[1].Operations).To(ConsistOf(MatchRegexp(`kapp deploy -n planned -a \w* cf-for-k8s-scp`)))
+		err = pkgManager.Delete(target, "docker.io/pkgs/cloud-foundry")
+		Expect(err).To(HaveOccurred())
+	})
+	landep.Repository.Register("test.io/pkgs/plan-failing", semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+		return &planFailingInstaller{}, nil
+	})
+	It("leaves the targets untouched when a plan fails", func() {
+		target := landep.NewK8sTarget("plan-failing", k8sConfig)
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "docker.io/pkgs/cluster", constraint, nil)
+		Expect(err).To(Succeed())
+
+		planner, err := landep.NewPackageManager(landep.Repository, testSecrets)
+		Expect(err).To(Succeed())
+		logs = nil
+		_, err = planner.Plan(target, "test.io/pkgs/plan-failing", constraint, nil)
+		Expect(err).To(MatchError(ContainSubstring("plan failed")))
+		Expect(logs).To(BeEmpty())
+
+		logs = nil
+		Expect(pkgManager.Delete(target, "docker.io/pkgs/cluster")).To(Succeed())
+		Expect(logs).To(HaveLen(2))
+		Expect(logs[1]).To(Equal("kubectl delete namespace plan-failing"))
+	})
+	var namespaceStarted, namespaceProceed chan struct{}
+	landep.Repository.Register("test.io/pkgs/namespace-blocking", semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+		return &namespaceBlockingInstaller{target: target.(landep.K8sTarget), started: namespaceStarted, proceed: namespaceProceed}, nil
+	})
+	It("keeps namespaces of installations applied concurrently", func() {
+		pkgManager, err := landep.NewPackageManager(landep.Repository, landep.WithWorkers(2), testSecrets)
+		Expect(err).To(Succeed())
+		target := landep.NewK8sTarget("concurrent", k8sConfig)
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "docker.io/pkgs/cluster", constraint, nil)
+		Expect(err).To(Succeed())
+
+		namespaceStarted = make(chan struct{})
+		namespaceProceed = make(chan struct{})
+		applied := make(chan error, 1)
+		go func() {
+			_, err := pkgManager.Apply(target, "test.io/pkgs/namespace-blocking", constraint, nil)
+			applied <- err
+		}()
+		<-namespaceStarted
+		logs = nil
+		Expect(pkgManager.Delete(target, "docker.io/pkgs/cluster")).To(Succeed())
+		close(namespaceProceed)
+		Expect(<-applied).To(Succeed())
+		Expect(logs).To(ConsistOf(MatchRegexp("helm delete -n concurrent \\w*")))
+
+		logs = nil
+		Expect(pkgManager.Delete(target, "test.io/pkgs/namespace-blocking")).To(Succeed())
+		Expect(logs).To(HaveLen(2))
+		Expect(logs[1]).To(Equal("kubectl delete namespace concurrent"))
+	})
+	It("works with spaces and service brokers sharing an organization", func() {
+		target := landep.NewCloudFoundryTarget(&landep.CloudFoundryConfig{CloudFoundryCredentials: landep.Credentials{URL: "https://api.cf.example.com"}})
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		org := landep.InstallationDigest(target, "docker.io/pkgs/organization")
+		space := landep.InstallationDigest(target, "docker.io/pkgs/space")
+		broker := landep.InstallationDigest(target, "docker.io/pkgs/service-broker")
+		By("applies the space", func() {
+			logs = nil
+			installation, err := pkgManager.Apply(target, "docker.io/pkgs/space", constraint, mustParameter(&SpaceParameter{
+				Organization: &OrganizationParameter{Username: "admin", Quota: &landep.CloudFoundryQuota{TotalMemoryInMB: 4096}},
+				Developers:   []string{"dev@example.com"},
+				Quota:        &landep.CloudFoundryQuota{TotalServiceInstances: 5},
+			}))
+			Expect(err).To(Succeed())
+			Expect(logs).To(Equal([]string{
+				"cf create org " + org,
+				"cf set org quota " + org + " -m 4096M -s unlimited -r unlimited",
+				"cf create space " + space + " -o " + org,
+				"cf set space quota " + space + " -o " + org + " -m unlimited -s 5 -r unlimited",
+				"cf set space role dev@example.com " + org + " " + space + " space_developer",
+			}))
+			var response SpaceResponse
+			Expect(json.Unmarshal(installation.Response, &response)).To(Succeed())
+			Expect(response).To(Equal(SpaceResponse{Organization: org, Name: space}))
+		})
+		By("applies the service broker", func() {
+			logs = nil
+			_, err := pkgManager.Apply(target, "docker.io/pkgs/service-broker", constraint, mustParameter(&ServiceBrokerParameter{
+				URL:         "https://broker.example.com",
+				Credentials: landep.BasicAuthorization{Username: "broker", Password: "broker-password"},
+			}))
+			Expect(err).To(Succeed())
+			// the organization is applied again for its new requester
+			Expect(logs).To(Equal([]string{
+				"cf create org " + org,
+				"cf set org quota " + org + " -m 4096M -s unlimited -r unlimited",
+				"cf create service broker " + broker + " https://broker.example.com",
+				"cf enable service access -b " + broker + " -o " + org,
+			}))
+		})
+		By("deletes", func() {
+			logs = nil
+			Expect(pkgManager.Delete(target, "docker.io/pkgs/service-broker")).To(Succeed())
+			Expect(logs).To(Equal([]string{"cf delete service broker " + broker}))
+			logs = nil
+			Expect(pkgManager.Delete(target, "docker.io/pkgs/space")).To(Succeed())
+			Expect(logs).To(Equal([]string{"cf delete space " + space, "cf delete org " + org}))
+		})
+	})
+	It("requires the url of service brokers", func() {
+		target := landep.NewCloudFoundryTarget(&landep.CloudFoundryConfig{CloudFoundryCredentials: landep.Credentials{URL: "https://api.cf.example.com"}})
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "docker.io/pkgs/service-broker", constraint, nil)
+		Expect(err).To(MatchError(ContainSubstring("url of service broker")))
+	})
+	It("applies and deletes independent dependencies in parallel", func() {
+		pkgManager, err := landep.NewPackageManager(landep.Repository, landep.WithWorkers(4), testSecrets)
+		Expect(err).To(Succeed())
+		target := landep.NewK8sTarget("parallel", k8sConfig)
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		By("applies", func() {
+			logs = nil
+			installation, err := pkgManager.Apply(target, "docker.io/pkgs/cloud-foundry-environment", constraint, nil)
+			Expect(err).To(Succeed())
+			Expect(logs).To(HaveLen(9))
+			Expect(logs[0]).To(MatchRegexp("kubectl create namespace parallel -l landep.io/installation=\\w*"))
+			Expect(logs[1]).To(MatchRegexp("helm upgrade -i -n parallel --version 1.0.1 \\w* cluster"))
+			Expect(logs[2]).To(MatchRegexp("kubectl create namespace istio-system -l landep.io/installation=\\w*"))
+			Expect(logs[3]).To(MatchRegexp("helm upgrade -i -n istio-system --version 1.7.0 \\w* istio"))
+			Expect(logs[4]).To(MatchRegexp("kubectl create namespace cf-system -l landep.io/installation=\\w*"))
+			Expect(logs[5]).To(MatchRegexp("kapp deploy -n cf-system -a \\w* cf-for-k8s-scp"))
+			Expect(logs[6:]).To(ConsistOf(
+				MatchRegexp("kubectl create namespace service-agent-manager -l landep.io/installation=\\w*"),
+				MatchRegexp("helm upgrade -i -n service-agent-manager --version 0.1.0 \\w* service-manager-agent"),
+				MatchRegexp("cf create org \\w*")))
+			extendedCloudFoundry := installation.Children[1].Installation
+			Expect(extendedCloudFoundry.Children).To(HaveLen(3))
+			Expect(extendedCloudFoundry.Children[0].Name).To(Equal("cloud-foundry"))
+			Expect(extendedCloudFoundry.Children[0].Stage).To(Equal(0))
+			Expect(extendedCloudFoundry.Children[1].Name).To(Equal("organization"))
+			Expect(extendedCloudFoundry.Children[1].Stage).To(Equal(1))
+			Expect(extendedCloudFoundry.Children[2].Name).To(Equal("service-manager-agent"))
+			Expect(extendedCloudFoundry.Children[2].Stage).To(Equal(1))
+		})
+		By("deletes", func() {
+			logs = nil
+			err = pkgManager.Delete(target, "docker.io/pkgs/cloud-foundry-environment")
+			Expect(err).To(Succeed())
+			Expect(logs).To(HaveLen(9))
+			Expect(logs[:3]).To(ConsistOf(
+				MatchRegexp("helm delete -n service-agent-manager \\w*"),
+				"kubectl delete namespace service-agent-manager",
+				MatchRegexp("cf delete org \\w*")))
+			Expect(logs[3]).To(MatchRegexp("kapp delete -n cf-system -a \\w*"))
+			Expect(logs[4]).To(MatchRegexp("helm delete -n istio-system \\w*"))
+			Expect(logs[5:7]).To(Equal([]string{"kubectl delete namespace istio-system", "kubectl delete namespace cf-system"}))
+			Expect(logs[7]).To(MatchRegexp("helm delete -n parallel \\w*"))
+			Expect(logs[8]).To(Equal("kubectl delete namespace parallel"))
+		})
+	})
+	It("redacts credentials in logs, plans and state dumps", func() {
+		redactor := landep.NewRedactor()
+		pkgManager, err := landep.NewPackageManager(landep.Repository, testSecrets, landep.WithRedactor(redactor))
+		Expect(err).To(Succeed())
+		target := landep.NewK8sTarget("redacted", k8sConfig)
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		By("plans", func() {
+			plan, err := pkgManager.Plan(target, "docker.io/pkgs/cloud-foundry-environment", constraint, nil)
+			Expect(err).To(Succeed())
+			Expect(plan.String()).To(ContainSubstring(`"CF_CLIENT_PASSWORD":"***"`))
+			Expect(plan.String()).NotTo(ContainSubstring(`:"password"`))
+		})
+		By("applies", func() {
+			logs = nil
+			_, err = pkgManager.Apply(target, "docker.io/pkgs/cloud-foundry-environment", constraint, nil)
+			Expect(err).To(Succeed())
+			Expect(logs).To(ContainElement(ContainSubstring(`"CF_CLIENT_PASSWORD":"***"`)))
+			Expect(logs).NotTo(ContainElement(ContainSubstring(`:"password"`)))
+		})
+		By("dumps the state", func() {
+			states, err := pkgManager.States()
+			Expect(err).To(Succeed())
+			for _, state := range states {
+				data, err := json.Marshal(state)
+				Expect(err).To(Succeed())
+				Expect(string(data)).NotTo(ContainSubstring(`:"password"`))
+				if state.PkgName == "docker.io/pkgs/service-manager-agent" {
+					Expect(state.Responses).NotTo(HaveKey("artifactory"))
+				}
+			}
+		})
+		By("sharing the redactor", func() {
+			Expect(redactor.Redact(`"CF_CLIENT_PASSWORD":"password"`)).To(Equal(`"CF_CLIENT_PASSWORD":"***"`))
+			Expect(landep.NewRedactor().Redact(`"CF_CLIENT_PASSWORD":"password"`)).To(Equal(`"CF_CLIENT_PASSWORD":"password"`))
+		})
+		err = pkgManager.Delete(target, "docker.io/pkgs/cloud-foundry-environment")
+		Expect(err).To(Succeed())
+	})
+	It("redacts registered secrets", func() {
+		redactor := landep.NewRedactor()
+		redactor.RegisterSecret(landep.Secret(`{"auths":{"docker.io":{"auth":"c2VjcmV0"}}}`))
+		redactor.RegisterSensitiveFields(landep.Parameter(`{"user":"admin","apiToken":"t0k3n"}`))
+		Expect(redactor.Redact("login with c2VjcmV0 and t0k3n as admin")).To(Equal("login with *** and *** as admin"))
+		err := redactor.RedactError(fmt.Errorf("invalid token t0k3n: %w", os.ErrPermission))
+		Expect(err.Error()).To(Equal("invalid token ***: permission denied"))
+		Expect(errors.Is(err, os.ErrPermission)).To(BeTrue())
+		Expect(string(redactor.RedactJSON(landep.Parameter(`{"password":"abc","user":"admin"}`)))).To(Equal(`{"password":"***","user":"admin"}`))
+	})
+	It("keeps the identity of redacted states", func() {
+		redactor := landep.NewRedactor()
+		pkgManager, err := landep.NewPackageManager(landep.Repository, testSecrets, landep.WithRedactor(redactor))
+		Expect(err).To(Succeed())
+		target := landep.NewK8sTarget("redacted-version", k8sConfig)
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		installation, err := pkgManager.Apply(target, "docker.io/pkgs/cluster", constraint, nil)
+		Expect(err).To(Succeed())
+		redactor.Register(installation.Version.String(), installation.Digest)
+		states, err := pkgManager.States()
+		Expect(err).To(Succeed())
+		Expect(states).To(HaveLen(1))
+		Expect(states[0].Digest).To(Equal(installation.Digest))
+		Expect(states[0].Version).To(Equal(installation.Version.String()))
+		Expect(pkgManager.Delete(target, "docker.io/pkgs/cluster")).To(Succeed())
+	})
+	It("remerges shared dependencies when a requester is deleted", func() {
+		pkgManager, err := landep.NewPackageManager(landep.Repository)
+		Expect(err).To(Succeed())
+		cfTarget := landep.NewK8sTarget("cf-system", k8sConfig)
+		kymaTarget := landep.NewK8sTarget("kyma-system", k8sConfig)
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(cfTarget, "docker.io/pkgs/cloud-foundry", constraint, nil)
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(kymaTarget, "docker.io/pkgs/kyma", constraint, nil)
+		Expect(err).To(Succeed())
+		By("reapplies istio with the parameters of cloud-foundry", func() {
+			logs = nil
+			err = pkgManager.Delete(kymaTarget, "docker.io/pkgs/kyma")
+			Expect(err).To(Succeed())
+			Expect(logs).To(HaveLen(3))
+			Expect(logs[0]).To(MatchRegexp("helm delete -n kyma-system \\w*"))
+			Expect(logs[1]).To(MatchRegexp(`helm upgrade -i -n istio-system --version 1.7.0 \w* istio \{"pilot":\{"instances":1\}\}`))
+			Expect(logs[2]).To(Equal("kubectl delete namespace kyma-system"))
+		})
+		By("doesn't reapply istio if the merged parameters don't change", func() {
+			_, err = pkgManager.Apply(kymaTarget, "docker.io/pkgs/kyma", constraint, nil)
+			Expect(err).To(Succeed())
+			logs = nil
+			err = pkgManager.Delete(cfTarget, "docker.io/pkgs/cloud-foundry")
+			Expect(err).To(Succeed())
+			Expect(logs).To(HaveLen(2))
+			Expect(logs[0]).To(MatchRegexp("kapp delete -n cf-system -a \\w*"))
+			Expect(logs[1]).To(Equal("kubectl delete namespace cf-system"))
+			err = pkgManager.Delete(kymaTarget, "docker.io/pkgs/kyma")
+			Expect(err).To(Succeed())
+		})
+	})
 })
+
+// planFailingInstaller requests docker.io/pkgs/cluster in its target and fails afterwards
+type planFailingInstaller struct{}
+
+func (s *planFailingInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	dummy := struct{}{}
+	if err := helper.InstallationRequest(&dummy, "cluster", "docker.io/pkgs/cluster", ">= 1.0").Error(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("plan failed")
+}
+
+func (s *planFailingInstaller) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+// namespaceBlockingInstaller deploys a helm chart into its target and blocks until proceed is closed
+type namespaceBlockingInstaller struct {
+	target  landep.K8sTarget
+	started chan struct{}
+	proceed chan struct{}
+}
+
+func (s *namespaceBlockingInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	if err := s.target.Helm().Apply(ctx, name, "blocking", semver.MustParse("1.0.0"), nil); err != nil {
+		return nil, err
+	}
+	close(s.started)
+	<-s.proceed
+	return nil, nil
+}
+
+func (s *namespaceBlockingInstaller) Delete(ctx context.Context, name string) error {
+	return s.target.Helm().Delete(ctx, name)
+}
@@ -1,6 +1,7 @@
 package installer
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -44,15 +45,15 @@ func istioConflictSolver(path string, j1 json.RawMessage, j2 json.RawMessage) (j
 	return nil, fmt.Errorf("Incompatible jsons at %s: '%s' '%s'", path, string(j1), string(j2))
 }
 
-func (s *istioInstaller) Apply(name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+func (s *istioInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
 	var params landep.Parameter
 	return helper.
 		MergedJsonParameter(&params, landep.WithConflictSolver(istioConflictSolver)).
 		Apply(func() (interface{}, error) {
-			return &IstioResponse{}, s.k8sTarget.Helm().Apply(name, "istio", s.version, params)
+			return &IstioResponse{}, s.k8sTarget.Helm().Apply(ctx, name, "istio", s.version, params)
 		})
 }
 
-func (s *istioInstaller) Delete(name string) error {
-	return s.k8sTarget.Helm().Delete(name)
+func (s *istioInstaller) Delete(ctx context.Context, name string) error {
+	return s.k8sTarget.Helm().Delete(ctx, name)
 }
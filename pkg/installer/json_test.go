@@ -0,0 +1,32 @@
+package installer
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+var _ = Describe("json", func() {
+	It("merges parameters with the last one winning", func() {
+		merged, err := landep.JsonMerge([]json.RawMessage{
+			json.RawMessage(`{"pilot":{"instances":1,"tag":"v1"},"enabled":false}`),
+			json.RawMessage(`{"pilot":{"instances":3}}`),
+			json.RawMessage(`{"enabled":true}`),
+		}, landep.WithConflictSolver(landep.LastWinsConflictSolver))
+		Expect(err).To(Succeed())
+		Expect(string(merged)).To(MatchJSON(`{"pilot":{"instances":3,"tag":"v1"},"enabled":true}`))
+	})
+
+	It("converts YAML to JSON", func() {
+		converted, err := landep.YamlToJson([]byte("pilot:\n  instances: 3\n  tags: [v1, v2]\nenabled: true\n"))
+		Expect(err).To(Succeed())
+		Expect(string(converted)).To(MatchJSON(`{"pilot":{"instances":3,"tags":["v1","v2"]},"enabled":true}`))
+		converted, err = landep.YamlToJson([]byte(`{"pilot":{"instances":3}}`))
+		Expect(err).To(Succeed())
+		Expect(string(converted)).To(MatchJSON(`{"pilot":{"instances":3}}`))
+		_, err = landep.YamlToJson([]byte("1: one\n"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -1,6 +1,7 @@
 package installer
 
 import (
+	"context"
 	"errors"
 
 	"github.com/Masterminds/semver/v3"
@@ -27,7 +28,7 @@ func kymaInstallerFactory(target landep.Target, version *semver.Version) (landep
 	return &kymaInstaller{k8sTarget: k8sTarget, version: version}, nil
 }
 
-func (s *kymaInstaller) Apply(name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+func (s *kymaInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
 	var params landep.Parameter
 	var istioResponse IstioResponse
 	return helper.
@@ -37,10 +38,10 @@ func (s *kymaInstaller) Apply(name string, images map[string]landep.Image, helpe
 			landep.WithJsonParameter(&IstioParameter{Pilot: Pilot{Instances: 3}}),
 		).
 		Apply(func() (interface{}, error) {
-			return &KymaResponse{}, s.k8sTarget.Helm().Apply(name, "kyma", s.version, params)
+			return &KymaResponse{}, s.k8sTarget.Helm().Apply(ctx, name, "kyma", s.version, params)
 		})
 }
 
-func (s *kymaInstaller) Delete(name string) error {
-	return s.k8sTarget.Helm().Delete(name)
+func (s *kymaInstaller) Delete(ctx context.Context, name string) error {
+	return s.k8sTarget.Helm().Delete(ctx, name)
 }
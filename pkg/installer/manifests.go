@@ -0,0 +1,51 @@
+package installer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Masterminds/semver/v3"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+type manifestsInstaller struct {
+	k8sTarget landep.K8sTarget
+	version   *semver.Version
+}
+
+// ManifestsParameter contains either YAML manifests or the directory of a kustomization
+type ManifestsParameter struct {
+	Manifests     string `json:"manifests,omitempty"`
+	Kustomization string `json:"kustomization,omitempty"`
+}
+
+type ManifestsResponse struct {
+}
+
+func init() {
+	landep.Repository.Register("docker.io/pkgs/manifests", semver.MustParse("1.0.0"), manifestsInstallerFactory)
+}
+
+func manifestsInstallerFactory(target landep.Target, version *semver.Version) (landep.Installer, error) {
+	k8sTarget, ok := target.(landep.K8sTarget)
+	if !ok {
+		return nil, errors.New("Not a K8sTarget")
+	}
+	return &manifestsInstaller{k8sTarget: k8sTarget, version: version}, nil
+}
+
+func (s *manifestsInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	var params ManifestsParameter
+	return helper.
+		MergedParameter(&params).
+		Apply(func() (interface{}, error) {
+			if params.Kustomization != "" {
+				return &ManifestsResponse{}, s.k8sTarget.Manifests().ApplyKustomization(ctx, name, params.Kustomization)
+			}
+			return &ManifestsResponse{}, s.k8sTarget.Manifests().Apply(ctx, name, []byte(params.Manifests))
+		})
+}
+
+func (s *manifestsInstaller) Delete(ctx context.Context, name string) error {
+	return s.k8sTarget.Manifests().Delete(ctx, name)
+}
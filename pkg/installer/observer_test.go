@@ -0,0 +1,126 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+type observedRootInstaller struct{}
+
+func (s *observedRootInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	dummy := struct{}{}
+	return helper.
+		InstallationRequest(&dummy, "flaky", "test.io/pkgs/observed-flaky", ">= 1.0").
+		Apply(func() (interface{}, error) {
+			return &dummy, nil
+		})
+}
+
+func (s *observedRootInstaller) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+var _ = Describe("observers", func() {
+	recorder := &testRecorder{}
+	failures := 0
+	landep.Repository.Register("test.io/pkgs/observed-flaky", semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+		return &flakyInstaller{recorder: recorder, failures: &failures, retryable: true}, nil
+	})
+	landep.Repository.Register("test.io/pkgs/observed-root", semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+		return &observedRootInstaller{}, nil
+	})
+
+	k8sConfig := &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"}
+	constraint, _ := semver.NewConstraint(">= 1.0")
+	retryPolicy := landep.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+
+	var events, audit []string
+	var pkgManager *landep.PackageManager
+
+	BeforeEach(func() {
+		events, audit = nil, nil
+		var err error
+		pkgManager, err = landep.NewPackageManager(landep.Repository,
+			landep.WithRetryPolicy(retryPolicy),
+			landep.WithObserver(landep.ObserverFunc(func(event landep.Event) {
+				events = append(events, fmt.Sprintf("%T %s", event, event.Installation().PkgName))
+			})),
+			landep.WithObserver(landep.ObserverFunc(func(event landep.Event) {
+				audit = append(audit, event.String())
+			})))
+		Expect(err).To(Succeed())
+	})
+
+	It("notifies all observers about the lifecycle of installations", func() {
+		failures = 1
+		target := landep.NewK8sTarget("observed", k8sConfig)
+		description := target.Description().String()
+		_, err := pkgManager.Apply(target, "test.io/pkgs/observed-root", constraint, nil)
+		Expect(err).To(Succeed())
+		Expect(events).To(Equal([]string{
+			"*landep.ResolutionStarted test.io/pkgs/observed-root",
+			"*landep.VersionSelected test.io/pkgs/observed-root",
+			"*landep.DependencyRequested test.io/pkgs/observed-root",
+			"*landep.ResolutionStarted test.io/pkgs/observed-flaky",
+			"*landep.VersionSelected test.io/pkgs/observed-flaky",
+			"*landep.InstallerApplied test.io/pkgs/observed-flaky",
+			"*landep.InstallerApplied test.io/pkgs/observed-root",
+		}))
+		Expect(audit).To(Equal([]string{
+			"resolving test.io/pkgs/observed-root on " + description + " (>=1.0) requested by package-manager",
+			"selected test.io/pkgs/observed-root:1.0.0 on " + description,
+			"test.io/pkgs/observed-root:1.0.0 on " + description + " requested test.io/pkgs/observed-flaky as flaky on " + description,
+			"resolving test.io/pkgs/observed-flaky on " + description + " (>=1.0) requested by test.io/pkgs/observed-root/" + landep.InstallationDigest(target, "test.io/pkgs/observed-root"),
+			"selected test.io/pkgs/observed-flaky:1.0.0 on " + description,
+			"applied test.io/pkgs/observed-flaky:1.0.0 on " + description + " (2 attempts)",
+			"applied test.io/pkgs/observed-root:1.0.0 on " + description + " (1 attempt)",
+		}))
+
+		events, audit = nil, nil
+		_, err = pkgManager.Apply(target, "test.io/pkgs/observed-root", constraint, nil)
+		Expect(err).To(Succeed())
+		Expect(audit).To(Equal([]string{
+			"resolving test.io/pkgs/observed-root on " + description + " (>=1.0) requested by package-manager",
+			"skipped test.io/pkgs/observed-root:1.0.0 on " + description + ": request of package-manager unchanged",
+		}))
+
+		events, audit = nil, nil
+		Expect(pkgManager.Delete(target, "test.io/pkgs/observed-root")).To(Succeed())
+		Expect(events).To(Equal([]string{
+			"*landep.InstallerDeleted test.io/pkgs/observed-root",
+			"*landep.InstallerDeleted test.io/pkgs/observed-flaky",
+		}))
+	})
+
+	It("reports failures with the number of attempts", func() {
+		failures = 3
+		target := landep.NewK8sTarget("observed", k8sConfig)
+		_, err := pkgManager.Apply(target, "test.io/pkgs/observed-flaky", constraint, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(events).To(Equal([]string{
+			"*landep.ResolutionStarted test.io/pkgs/observed-flaky",
+			"*landep.VersionSelected test.io/pkgs/observed-flaky",
+			"*landep.Failed test.io/pkgs/observed-flaky",
+		}))
+		Expect(audit[2]).To(Equal("failed test.io/pkgs/observed-flaky:1.0.0 on " + target.Description().String() + " (3 attempts): failed after 3 attempts: connection reset"))
+	})
+
+	It("reports resolution failures", func() {
+		target := landep.NewK8sTarget("observed", k8sConfig)
+		constraint, err := semver.NewConstraint(">= 2.0")
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "test.io/pkgs/observed-flaky", constraint, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(events).To(Equal([]string{
+			"*landep.ResolutionStarted test.io/pkgs/observed-flaky",
+			"*landep.Failed test.io/pkgs/observed-flaky",
+		}))
+		Expect(audit[1]).To(HavePrefix("failed test.io/pkgs/observed-flaky on " + target.Description().String() + ": "))
+	})
+})
@@ -1,6 +1,7 @@
 package installer
 
 import (
+	"context"
 	"errors"
 
 	"github.com/Masterminds/semver/v3"
@@ -13,7 +14,12 @@ type organizationInstaller struct {
 }
 
 type OrganizationParameter struct {
-	Username string `json:"username"`
+	Username string                    `json:"username"`
+	Quota    *landep.CloudFoundryQuota `json:"quota,omitempty"`
+}
+
+type OrganizationResponse struct {
+	Name string `json:"name"`
 }
 
 func init() {
@@ -28,16 +34,22 @@ func organizationInstallerFactory(target landep.Target, version *semver.Version)
 	return &organizationInstaller{cfTarget: cfTarget, version: version}, nil
 }
 
-func (s *organizationInstaller) Apply(name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+func (s *organizationInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
 	orgParams := OrganizationParameter{Username: "admin"}
 	return helper.
 		MergedParameter(&orgParams).
 		Apply(func() (interface{}, error) {
-			err := s.cfTarget.CreateOrg(name, orgParams.Username)
-			return &struct{}{}, err
+			err := s.cfTarget.CreateOrg(ctx, name, orgParams.Username)
+			if err != nil {
+				return nil, err
+			}
+			if orgParams.Quota != nil {
+				err = s.cfTarget.SetOrgQuota(ctx, name, *orgParams.Quota)
+			}
+			return &OrganizationResponse{Name: name}, err
 		})
 }
 
-func (s *organizationInstaller) Delete(name string) error {
-	return s.cfTarget.DeleteOrg(name)
+func (s *organizationInstaller) Delete(ctx context.Context, name string) error {
+	return s.cfTarget.DeleteOrg(ctx, name)
 }
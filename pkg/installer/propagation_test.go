@@ -0,0 +1,84 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+type propagatedResponse struct {
+	Parameter  landep.Parameter    `json:"parameter,omitempty"`
+	Dependency *propagatedResponse `json:"dependency,omitempty"`
+}
+
+// propagatedInstaller responds with its merged parameter and the response of its dependency
+type propagatedInstaller struct {
+	pkgName    string
+	dependency string
+	parameter  interface{}
+	recorder   *testRecorder
+}
+
+func (s *propagatedInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	response := propagatedResponse{}
+	helper.MergedJsonParameter(&response.Parameter, landep.WithConflictSolver(landep.MaximumConflictSolver))
+	if s.dependency != "" {
+		var options []landep.InstallationOption
+		if s.parameter != nil {
+			options = append(options, landep.WithJsonParameter(s.parameter))
+		}
+		response.Dependency = &propagatedResponse{}
+		helper.InstallationRequest(response.Dependency, "dependency", s.dependency, ">= 1.0", options...)
+	}
+	return helper.Apply(func() (interface{}, error) {
+		s.recorder.record("apply %s %s", s.pkgName, string(response.Parameter))
+		return &response, nil
+	})
+}
+
+func (s *propagatedInstaller) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+var _ = Describe("response propagation", func() {
+	recorder := &testRecorder{}
+	register := func(pkgName string, dependency string, parameter interface{}) {
+		landep.Repository.Register(pkgName, semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+			return &propagatedInstaller{pkgName: pkgName, dependency: dependency, parameter: parameter, recorder: recorder}, nil
+		})
+	}
+	register("test.io/pkgs/propagated-shared", "", nil)
+	register("test.io/pkgs/propagated-a", "test.io/pkgs/propagated-shared", map[string]int{"size": 1})
+	register("test.io/pkgs/propagated-root", "test.io/pkgs/propagated-a", nil)
+	register("test.io/pkgs/propagated-b", "test.io/pkgs/propagated-shared", map[string]int{"size": 2})
+
+	It("reapplies dependents of changed responses in topological order", func() {
+		pkgManager, err := landep.NewPackageManager(landep.Repository)
+		Expect(err).To(Succeed())
+		target := landep.NewK8sTarget("propagated", &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"})
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		root, err := pkgManager.Apply(target, "test.io/pkgs/propagated-root", constraint, nil)
+		Expect(err).To(Succeed())
+		Expect(recorder.reset()).To(Equal([]string{
+			`apply test.io/pkgs/propagated-shared {"size":1}`,
+			"apply test.io/pkgs/propagated-a ",
+			"apply test.io/pkgs/propagated-root ",
+		}))
+		_, err = pkgManager.Apply(target, "test.io/pkgs/propagated-b", constraint, nil)
+		Expect(err).To(Succeed())
+		Expect(recorder.reset()).To(Equal([]string{
+			`apply test.io/pkgs/propagated-shared {"size":2}`,
+			"apply test.io/pkgs/propagated-b ",
+			"apply test.io/pkgs/propagated-a ",
+			"apply test.io/pkgs/propagated-root ",
+		}))
+		var response propagatedResponse
+		Expect(json.Unmarshal(root.Response, &response)).To(Succeed())
+		Expect(string(response.Dependency.Dependency.Parameter)).To(Equal(`{"size":2}`))
+	})
+})
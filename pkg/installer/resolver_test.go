@@ -0,0 +1,113 @@
+package installer
+
+import (
+	"context"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+type resolvedResponse struct {
+	Version string `json:"version"`
+}
+
+// resolvedInstaller requests test.io/pkgs/resolved-shared with the given constraints, if any,
+// and responds with its version
+type resolvedInstaller struct {
+	pkgName     string
+	version     *semver.Version
+	constraints string
+	recorder    *testRecorder
+}
+
+func (s *resolvedInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	if s.constraints != "" {
+		var shared resolvedResponse
+		helper.InstallationRequest(&shared, "shared", "test.io/pkgs/resolved-shared", s.constraints)
+	}
+	return helper.Apply(func() (interface{}, error) {
+		s.recorder.record("apply %s %s", s.pkgName, s.version)
+		return &resolvedResponse{Version: s.version.String()}, nil
+	})
+}
+
+func (s *resolvedInstaller) Delete(ctx context.Context, name string) error {
+	s.recorder.record("delete %s %s", s.pkgName, s.version)
+	return nil
+}
+
+var _ = Describe("version resolution", func() {
+	recorder := &testRecorder{}
+	register := func(pkgName string, version string, constraints string) {
+		landep.Repository.Register(pkgName, semver.MustParse(version), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+			return &resolvedInstaller{pkgName: pkgName, version: version, constraints: constraints, recorder: recorder}, nil
+		})
+	}
+	register("test.io/pkgs/resolved-shared", "1.6.0", "")
+	register("test.io/pkgs/resolved-shared", "1.7.0", "")
+	register("test.io/pkgs/resolved-shared", "1.8.0", "")
+	register("test.io/pkgs/resolved-loose", "1.0.0", ">= 1.6")
+	register("test.io/pkgs/resolved-tight", "1.0.0", "~ 1.7")
+	register("test.io/pkgs/resolved-conflicting", "1.0.0", ">= 1.8")
+
+	k8sConfig := &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"}
+	constraint, _ := semver.NewConstraint(">= 1.0")
+
+	It("selects a version satisfying all requesters", func() {
+		pkgManager, err := landep.NewPackageManager(landep.Repository)
+		Expect(err).To(Succeed())
+		target := landep.NewK8sTarget("resolved", k8sConfig)
+		By("applies the loose requester", func() {
+			_, err = pkgManager.Apply(target, "test.io/pkgs/resolved-loose", constraint, nil)
+			Expect(err).To(Succeed())
+			Expect(recorder.reset()).To(Equal([]string{
+				"apply test.io/pkgs/resolved-shared 1.8.0",
+				"apply test.io/pkgs/resolved-loose 1.0.0",
+			}))
+		})
+		By("reapplies the shared installation with a version satisfying the tight requester", func() {
+			_, err = pkgManager.Apply(target, "test.io/pkgs/resolved-tight", constraint, nil)
+			Expect(err).To(Succeed())
+			Expect(recorder.reset()).To(Equal([]string{
+				"apply test.io/pkgs/resolved-shared 1.7.0",
+				"apply test.io/pkgs/resolved-tight 1.0.0",
+				// consumed the response of version 1.8.0
+				"apply test.io/pkgs/resolved-loose 1.0.0",
+			}))
+		})
+		By("fails naming the conflicting requester", func() {
+			_, err = pkgManager.Apply(target, "test.io/pkgs/resolved-conflicting", constraint, nil)
+			Expect(err).To(HaveOccurred())
+			conflict, ok := err.(*landep.VersionConflict)
+			Expect(ok).To(BeTrue())
+			Expect(conflict.PkgName).To(Equal("test.io/pkgs/resolved-shared"))
+			Expect(conflict.Versions).To(Equal([]string{"1.8.0", "1.7.0", "1.6.0"}))
+			Expect(conflict.Requesters).To(HaveLen(3))
+			conflicting := []string{}
+			for _, r := range conflict.Requesters {
+				if r.Conflicting {
+					conflicting = append(conflicting, r.Constraints)
+				}
+			}
+			Expect(conflicting).To(ConsistOf("~1.7", ">=1.8"))
+			Expect(err.Error()).To(MatchRegexp(`test.io/pkgs/resolved-tight/\w+ requires ~1.7 \(allows 1.7.0\)`))
+			Expect(err.Error()).To(MatchRegexp(`test.io/pkgs/resolved-conflicting/\w+ requires >=1.8 \(allows 1.8.0\)`))
+			Expect(recorder.reset()).To(BeEmpty())
+		})
+		By("reapplies the shared installation with the highest version once the tight requester is deleted", func() {
+			err = pkgManager.Delete(target, "test.io/pkgs/resolved-tight")
+			Expect(err).To(Succeed())
+			err = pkgManager.Delete(target, "test.io/pkgs/resolved-loose")
+			Expect(err).To(Succeed())
+			Expect(recorder.reset()).To(Equal([]string{
+				"delete test.io/pkgs/resolved-tight 1.0.0",
+				"apply test.io/pkgs/resolved-shared 1.8.0",
+				"apply test.io/pkgs/resolved-loose 1.0.0",
+				"delete test.io/pkgs/resolved-loose 1.0.0",
+				"delete test.io/pkgs/resolved-shared 1.8.0",
+			}))
+		})
+	})
+})
@@ -0,0 +1,129 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+type flakyInstaller struct {
+	recorder  *testRecorder
+	failures  *int
+	retryable bool
+}
+
+func (s *flakyInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	s.recorder.record("apply test.io/pkgs/flaky")
+	if *s.failures > 0 {
+		*s.failures--
+		if s.retryable {
+			return nil, landep.NewRetryable(errors.New("connection reset"))
+		}
+		return nil, errors.New("forbidden")
+	}
+	return helper.Apply(func() (interface{}, error) {
+		return &struct{}{}, nil
+	})
+}
+
+func (s *flakyInstaller) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+type flakyRootInstaller struct {
+	recorder *testRecorder
+}
+
+func (s *flakyRootInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	dummy := struct{}{}
+	return helper.
+		InstallationRequest(&dummy, "flaky", "test.io/pkgs/flaky", ">= 1.0").
+		Apply(func() (interface{}, error) {
+			s.recorder.record("apply test.io/pkgs/flaky-root")
+			return &dummy, nil
+		})
+}
+
+func (s *flakyRootInstaller) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+var _ = Describe("retries", func() {
+	recorder := &testRecorder{}
+	failures := 0
+	retryable := true
+	landep.Repository.Register("test.io/pkgs/flaky", semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+		return &flakyInstaller{recorder: recorder, failures: &failures, retryable: retryable}, nil
+	})
+	landep.Repository.Register("test.io/pkgs/flaky-root", semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+		return &flakyRootInstaller{recorder: recorder}, nil
+	})
+
+	k8sConfig := &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"}
+	constraint, _ := semver.NewConstraint(">= 1.0")
+	retryPolicy := landep.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+
+	BeforeEach(func() {
+		recorder.reset()
+	})
+
+	It("retries retryable failures", func() {
+		failures, retryable = 2, true
+		target := landep.NewK8sTarget("retry", k8sConfig)
+		pkgManager, err := landep.NewPackageManager(landep.Repository, landep.WithRetryPolicy(retryPolicy))
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "test.io/pkgs/flaky-root", constraint, nil)
+		Expect(err).To(Succeed())
+		Expect(recorder.reset()).To(Equal([]string{
+			"apply test.io/pkgs/flaky",
+			"apply test.io/pkgs/flaky",
+			"apply test.io/pkgs/flaky",
+			"apply test.io/pkgs/flaky-root",
+		}))
+	})
+
+	It("reports the number of attempts if all attempts failed", func() {
+		failures, retryable = 5, true
+		target := landep.NewK8sTarget("retry-exhausted", k8sConfig)
+		pkgManager, err := landep.NewPackageManager(landep.Repository, landep.WithRetryPolicy(retryPolicy))
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "test.io/pkgs/flaky", constraint, nil)
+		var failedAttempts *landep.FailedAttempts
+		Expect(errors.As(err, &failedAttempts)).To(BeTrue())
+		Expect(failedAttempts.Attempts).To(Equal(3))
+		Expect(landep.IsRetryable(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("failed after 3 attempts: connection reset"))
+		Expect(recorder.reset()).To(HaveLen(3))
+	})
+
+	It("doesn't retry other failures", func() {
+		failures, retryable = 1, false
+		target := landep.NewK8sTarget("retry-permanent", k8sConfig)
+		pkgManager, err := landep.NewPackageManager(landep.Repository, landep.WithRetryPolicy(retryPolicy))
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "test.io/pkgs/flaky", constraint, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(landep.IsRetryable(err)).To(BeFalse())
+		Expect(err.Error()).To(ContainSubstring("forbidden"))
+		Expect(recorder.reset()).To(HaveLen(1))
+	})
+
+	It("stops retrying if the context is cancelled", func() {
+		failures, retryable = 5, true
+		target := landep.NewK8sTarget("retry-cancelled", k8sConfig)
+		pkgManager, err := landep.NewPackageManager(landep.Repository,
+			landep.WithRetryPolicy(landep.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour}))
+		Expect(err).To(Succeed())
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = pkgManager.ApplyContext(ctx, target, "test.io/pkgs/flaky", constraint, nil)
+		var interrupted *landep.Interrupted
+		Expect(errors.As(err, &interrupted)).To(BeTrue())
+		Expect(recorder.reset()).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,113 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+var _ = Describe("secret resolvers", func() {
+	var dir string
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "landep-secrets")
+		Expect(err).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("reads secrets from environment variables", func() {
+		os.Setenv("LANDEP_TEST_SECRET", `{"user":"admin"}`)
+		defer os.Unsetenv("LANDEP_TEST_SECRET")
+		secret, err := landep.EnvSecretResolver{}.Resolve(ctx, "LANDEP_TEST_SECRET")
+		Expect(err).To(Succeed())
+		Expect(string(secret)).To(Equal(`{"user":"admin"}`))
+		os.Setenv("LANDEP_TEST_SECRET", "s3cr3t\n")
+		secret, err = landep.EnvSecretResolver{}.Resolve(ctx, "LANDEP_TEST_SECRET")
+		Expect(err).To(Succeed())
+		Expect(string(secret)).To(Equal("s3cr3t\n"))
+		_, err = landep.EnvSecretResolver{}.Resolve(ctx, "LANDEP_TEST_UNKNOWN")
+		var notFound *landep.SecretNotFound
+		Expect(errors.As(err, &notFound)).To(BeTrue())
+		Expect(notFound.Name).To(Equal("LANDEP_TEST_UNKNOWN"))
+	})
+
+	It("reads secrets from files in a directory", func() {
+		Expect(ioutil.WriteFile(filepath.Join(dir, "ARTIFACTORY"), []byte("{\"auths\":{}}\n"), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "PASSWORD"), []byte("\"s3cr3t\""), 0600)).To(Succeed())
+		resolver := landep.NewDirectorySecretResolver(dir)
+		secret, err := resolver.Resolve(ctx, "ARTIFACTORY")
+		Expect(err).To(Succeed())
+		Expect(string(secret)).To(Equal("{\"auths\":{}}\n"))
+		secret, err = resolver.Resolve(ctx, "PASSWORD")
+		Expect(err).To(Succeed())
+		Expect(string(secret)).To(Equal(`"s3cr3t"`))
+		_, err = resolver.Resolve(ctx, "UNKNOWN")
+		Expect(err).To(BeAssignableToTypeOf(&landep.SecretNotFound{}))
+		_, err = resolver.Resolve(ctx, "../ARTIFACTORY")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reads secrets from a YAML file", func() {
+		path := filepath.Join(dir, "secrets.yaml")
+		Expect(ioutil.WriteFile(path, []byte("ARTIFACTORY:\n  auths:\n    docker.io:\n      auth: abc\nTOKEN: xyz\n"), 0600)).To(Succeed())
+		resolver := landep.NewFileSecretResolver(path)
+		secret, err := resolver.Resolve(ctx, "ARTIFACTORY")
+		Expect(err).To(Succeed())
+		Expect(string(secret)).To(MatchJSON(`{"auths":{"docker.io":{"auth":"abc"}}}`))
+		secret, err = resolver.Resolve(ctx, "TOKEN")
+		Expect(err).To(Succeed())
+		Expect(string(secret)).To(Equal(`"xyz"`))
+		_, err = resolver.Resolve(ctx, "UNKNOWN")
+		Expect(err).To(BeAssignableToTypeOf(&landep.SecretNotFound{}))
+	})
+
+	It("reads secrets from a JSON file", func() {
+		path := filepath.Join(dir, "secrets.json")
+		Expect(ioutil.WriteFile(path, []byte(`{"ARTIFACTORY":{"auths":{}}}`), 0600)).To(Succeed())
+		secret, err := landep.NewFileSecretResolver(path).Resolve(ctx, "ARTIFACTORY")
+		Expect(err).To(Succeed())
+		Expect(string(secret)).To(MatchJSON(`{"auths":{}}`))
+	})
+
+	It("tries chained resolvers in order", func() {
+		Expect(ioutil.WriteFile(filepath.Join(dir, "ARTIFACTORY"), []byte(`{"from":"directory"}`), 0600)).To(Succeed())
+		path := filepath.Join(dir, "secrets.json")
+		Expect(ioutil.WriteFile(path, []byte(`{"ARTIFACTORY":{"from":"file"},"TOKEN":"xyz"}`), 0600)).To(Succeed())
+		resolver := landep.ChainSecretResolver{landep.NewDirectorySecretResolver(dir), landep.NewFileSecretResolver(path)}
+		secret, err := resolver.Resolve(ctx, "ARTIFACTORY")
+		Expect(err).To(Succeed())
+		Expect(string(secret)).To(Equal(`{"from":"directory"}`))
+		secret, err = resolver.Resolve(ctx, "TOKEN")
+		Expect(err).To(Succeed())
+		Expect(string(secret)).To(Equal(`"xyz"`))
+		_, err = resolver.Resolve(ctx, "UNKNOWN")
+		Expect(err).To(MatchError(ContainSubstring("secret UNKNOWN not found in " + dir + ", " + path)))
+	})
+
+	It("fails the installation with SecretNotFound", func() {
+		pkgManager, err := landep.NewPackageManager(landep.Repository,
+			landep.WithSecretResolver(landep.NewDirectorySecretResolver(dir)))
+		Expect(err).To(Succeed())
+		target := landep.NewK8sCloudFoundryBridgingTarget(
+			landep.NewK8sTarget("secrets", &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"}),
+			landep.NewCloudFoundryTarget(&landep.CloudFoundryConfig{}))
+		constraint, err := semver.NewConstraint(">= 0.1")
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "docker.io/pkgs/service-manager-agent", constraint, nil)
+		var notFound *landep.SecretNotFound
+		Expect(errors.As(err, &notFound)).To(BeTrue())
+		Expect(notFound.Name).To(Equal("ARTIFACTORY"))
+	})
+})
@@ -0,0 +1,69 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+type serviceBrokerInstaller struct {
+	cfTarget landep.CloudFoundryTarget
+	version  *semver.Version
+}
+
+type ServiceBrokerParameter struct {
+	URL         string                    `json:"url"`
+	Credentials landep.BasicAuthorization `json:"credentials"`
+	// Public enables the service access for all organizations instead of the requested one
+	Public bool `json:"public,omitempty"`
+}
+
+type ServiceBrokerResponse struct {
+	Name         string `json:"name"`
+	Organization string `json:"organization"`
+}
+
+func init() {
+	landep.Repository.Register("docker.io/pkgs/service-broker", semver.MustParse("1.0.0"), serviceBrokerInstallerFactory)
+}
+
+func serviceBrokerInstallerFactory(target landep.Target, version *semver.Version) (landep.Installer, error) {
+	cfTarget, ok := target.(landep.CloudFoundryTarget)
+	if !ok {
+		return nil, errors.New("Not a CloudFoundryTarget")
+	}
+	return &serviceBrokerInstaller{cfTarget: cfTarget, version: version}, nil
+}
+
+func (s *serviceBrokerInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	var params ServiceBrokerParameter
+	var orgResponse OrganizationResponse
+	return helper.
+		MergedParameter(&params).
+		InstallationRequest(&orgResponse, "organization", "docker.io/pkgs/organization", ">= 1.0", landep.WithTarget(s.cfTarget)).
+		Apply(func() (interface{}, error) {
+			if params.URL == "" {
+				return nil, fmt.Errorf("url of service broker %s missing", name)
+			}
+			err := s.cfTarget.RegisterServiceBroker(ctx, landep.ServiceBroker{Name: name, URL: params.URL, Credentials: params.Credentials})
+			if err != nil {
+				return nil, err
+			}
+			var orgs []string
+			if !params.Public {
+				orgs = []string{orgResponse.Name}
+			}
+			err = s.cfTarget.EnableServiceAccess(ctx, name, orgs)
+			if err != nil {
+				return nil, err
+			}
+			return &ServiceBrokerResponse{Name: name, Organization: orgResponse.Name}, nil
+		})
+}
+
+func (s *serviceBrokerInstaller) Delete(ctx context.Context, name string) error {
+	return s.cfTarget.DeleteServiceBroker(ctx, name)
+}
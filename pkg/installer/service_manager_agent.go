@@ -1,6 +1,7 @@
 package installer
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 
@@ -38,7 +39,7 @@ func serviceManagerAgentInstallerFactory(target landep.Target, version *semver.V
 	return &serviceManagerAgentInstaller{target: cTarget, version: version}, nil
 }
 
-func (s *serviceManagerAgentInstaller) Apply(name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+func (s *serviceManagerAgentInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
 	var artifactory ImagePullSecrets
 	var params ServiceManagerAgentParams
 
@@ -59,10 +60,10 @@ func (s *serviceManagerAgentInstaller) Apply(name string, images map[string]land
 			if err != nil {
 				return nil, err
 			}
-			return &ServiceManagerAgentResponse{}, s.target.K8sTarget().Helm().Apply(name, "service-manager-agent", s.version, jsonParams)
+			return &ServiceManagerAgentResponse{}, s.target.K8sTarget().Helm().Apply(ctx, name, "service-manager-agent", s.version, jsonParams)
 		})
 }
 
-func (s *serviceManagerAgentInstaller) Delete(name string) error {
-	return s.target.K8sTarget().Helm().Delete(name)
+func (s *serviceManagerAgentInstaller) Delete(ctx context.Context, name string) error {
+	return s.target.K8sTarget().Helm().Delete(ctx, name)
 }
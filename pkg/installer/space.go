@@ -0,0 +1,80 @@
+package installer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Masterminds/semver/v3"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+type spaceInstaller struct {
+	cfTarget landep.CloudFoundryTarget
+	version  *semver.Version
+}
+
+type SpaceParameter struct {
+	Organization *OrganizationParameter    `json:"organization,omitempty"`
+	Managers     []string                  `json:"managers,omitempty"`
+	Developers   []string                  `json:"developers,omitempty"`
+	Quota        *landep.CloudFoundryQuota `json:"quota,omitempty"`
+}
+
+type SpaceResponse struct {
+	Organization string `json:"organization"`
+	Name         string `json:"name"`
+}
+
+func init() {
+	landep.Repository.Register("docker.io/pkgs/space", semver.MustParse("1.0.0"), spaceInstallerFactory)
+}
+
+func spaceInstallerFactory(target landep.Target, version *semver.Version) (landep.Installer, error) {
+	cfTarget, ok := target.(landep.CloudFoundryTarget)
+	if !ok {
+		return nil, errors.New("Not a CloudFoundryTarget")
+	}
+	return &spaceInstaller{cfTarget: cfTarget, version: version}, nil
+}
+
+func (s *spaceInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	var params SpaceParameter
+	var orgResponse OrganizationResponse
+	helper.MergedParameter(&params)
+	if helper.Error() != nil {
+		return nil, helper.Error()
+	}
+	options := []landep.InstallationOption{landep.WithTarget(s.cfTarget)}
+	if params.Organization != nil {
+		options = append(options, landep.WithJsonParameter(params.Organization))
+	}
+	return helper.
+		InstallationRequest(&orgResponse, "organization", "docker.io/pkgs/organization", ">= 1.0", options...).
+		Apply(func() (interface{}, error) {
+			err := s.cfTarget.CreateSpace(ctx, orgResponse.Name, name)
+			if err != nil {
+				return nil, err
+			}
+			if params.Quota != nil {
+				err = s.cfTarget.SetSpaceQuota(ctx, orgResponse.Name, name, *params.Quota)
+				if err != nil {
+					return nil, err
+				}
+			}
+			roles := map[landep.CloudFoundryRole][]string{landep.SpaceManagerRole: params.Managers, landep.SpaceDeveloperRole: params.Developers}
+			for _, role := range []landep.CloudFoundryRole{landep.SpaceManagerRole, landep.SpaceDeveloperRole} {
+				for _, user := range roles[role] {
+					err = s.cfTarget.AssignSpaceRole(ctx, orgResponse.Name, name, user, role)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+			return &SpaceResponse{Organization: orgResponse.Name, Name: name}, nil
+		})
+}
+
+// Delete deletes the space. Its quota is deleted together with the organization.
+func (s *spaceInstaller) Delete(ctx context.Context, name string) error {
+	return s.cfTarget.DeleteSpace(ctx, name)
+}
@@ -0,0 +1,151 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+const targetsFile = `
+targets:
+  cluster:
+    kind: k8s
+    namespace: default
+    k8s:
+      url: https://gardener.canary.hana-ondemand.com
+  cf:
+    kind: cloudfoundry
+    cloudFoundry:
+      cf:
+        url: https://api.cf.example.com
+        secretRef: CF_CREDENTIALS
+      uaa:
+        url: https://uaa.cf.example.com
+        basic:
+          username: uaa-admin
+          password: uaa-secret
+  agent:
+    kind: k8s-cloudfoundry-bridging
+    k8sTarget: cluster
+    cloudFoundryTarget: cf
+  broken:
+    kind: k8s-cloudfoundry-bridging
+    k8sTarget: cf
+    cloudFoundryTarget: cf
+`
+
+var _ = Describe("targets file", func() {
+	var targets *landep.TargetsFile
+	ctx := context.Background()
+	secretResolver := landep.SecretResolverFunc(func(ctx context.Context, name string) (landep.Secret, error) {
+		if name == "CF_CREDENTIALS" {
+			return landep.Secret(`{"username":"cf-admin","password":"cf-secret"}`), nil
+		}
+		return nil, &landep.SecretNotFound{Name: name, Source: "test"}
+	})
+
+	BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "landep-targets")
+		Expect(err).To(Succeed())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "targets.yaml")
+		Expect(ioutil.WriteFile(path, []byte(targetsFile), 0600)).To(Succeed())
+		targets, err = landep.LoadTargetsFile(path)
+		Expect(err).To(Succeed())
+	})
+
+	It("builds k8s targets", func() {
+		target, err := targets.Target(ctx, "cluster", secretResolver)
+		Expect(err).To(Succeed())
+		Expect(target.Description()).To(Equal(&landep.TargetDescription{
+			Kind:      landep.K8sTargetKind,
+			Namespace: "default",
+			K8sConfig: &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"},
+		}))
+	})
+
+	It("builds cloud foundry targets with credentials from secrets", func() {
+		target, err := targets.Target(ctx, "cf", secretResolver)
+		Expect(err).To(Succeed())
+		cfTarget, ok := target.(landep.CloudFoundryTarget)
+		Expect(ok).To(BeTrue())
+		Expect(cfTarget.Config().CloudFoundryCredentials).To(Equal(landep.Credentials{
+			URL:       "https://api.cf.example.com",
+			Basic:     landep.BasicAuthorization{Username: "cf-admin", Password: "cf-secret"},
+			SecretRef: "CF_CREDENTIALS",
+		}))
+		Expect(cfTarget.Config().UAACredentials.Basic.Password).To(Equal("uaa-secret"))
+
+		pkgManager, err := landep.NewPackageManager(landep.Repository)
+		Expect(err).To(Succeed())
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "docker.io/pkgs/organization", constraint, nil)
+		Expect(err).To(Succeed())
+		Expect(pkgManager.Delete(target, "docker.io/pkgs/organization")).To(Succeed())
+	})
+
+	It("persists references to secrets instead of the credentials", func() {
+		target, err := targets.Target(ctx, "cf", secretResolver)
+		Expect(err).To(Succeed())
+		dir, err := ioutil.TempDir("", "landep-state")
+		Expect(err).To(Succeed())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "state.json")
+		pkgManager, err := landep.NewPackageManager(landep.Repository,
+			landep.WithStateStore(landep.NewFileStateStore(path)), landep.WithSecretResolver(secretResolver))
+		Expect(err).To(Succeed())
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "docker.io/pkgs/organization", constraint, nil)
+		Expect(err).To(Succeed())
+
+		data, err := ioutil.ReadFile(path)
+		Expect(err).To(Succeed())
+		Expect(string(data)).To(ContainSubstring(`"secretRef": "CF_CREDENTIALS"`))
+		Expect(string(data)).NotTo(ContainSubstring("cf-secret"))
+
+		By("resolving the references when loading the state", func() {
+			pkgManager, err = landep.NewPackageManager(landep.Repository,
+				landep.WithStateStore(landep.NewFileStateStore(path)), landep.WithSecretResolver(secretResolver))
+			Expect(err).To(Succeed())
+			nodes := pkgManager.Graph().Nodes
+			Expect(nodes).To(HaveLen(1))
+			Expect(nodes[0].Target.CloudFoundryConfig.CloudFoundryCredentials.Basic.Password).To(Equal("cf-secret"))
+			_, err = landep.NewPackageManager(landep.Repository, landep.WithStateStore(landep.NewFileStateStore(path)),
+				landep.WithSecretResolver(landep.SecretResolverFunc(func(ctx context.Context, name string) (landep.Secret, error) {
+					return nil, &landep.SecretNotFound{Name: name, Source: "test"}
+				})))
+			var notFound *landep.SecretNotFound
+			Expect(errors.As(err, &notFound)).To(BeTrue())
+		})
+		Expect(pkgManager.Delete(target, "docker.io/pkgs/organization")).To(Succeed())
+	})
+
+	It("builds bridging targets from referenced targets", func() {
+		target, err := targets.Target(ctx, "agent", secretResolver)
+		Expect(err).To(Succeed())
+		bridgingTarget, ok := target.(landep.K8sCloudFoundryBridgingTarget)
+		Expect(ok).To(BeTrue())
+		Expect(bridgingTarget.K8sTarget().Description().Namespace).To(Equal("default"))
+		Expect(bridgingTarget.CloudFoundryTarget().Config().CloudFoundryCredentials.URL).To(Equal("https://api.cf.example.com"))
+	})
+
+	It("reports invalid targets", func() {
+		_, err := targets.Target(ctx, "unknown", secretResolver)
+		Expect(err).To(MatchError("target unknown not defined"))
+		_, err = targets.Target(ctx, "broken", secretResolver)
+		Expect(err).To(MatchError("target cf referenced by broken is no k8s target"))
+		_, err = targets.Target(ctx, "cf", landep.EnvSecretResolver{})
+		var notFound *landep.SecretNotFound
+		Expect(errors.As(err, &notFound)).To(BeTrue())
+		Expect(err.Error()).To(HavePrefix("invalid credentials of target cf"))
+	})
+})
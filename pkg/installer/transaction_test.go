@@ -0,0 +1,116 @@
+package installer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.tools.sap/D001323/landep/pkg/landep"
+)
+
+type failingInstaller struct {
+	recorder *testRecorder
+}
+
+func (s *failingInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	s.recorder.record("apply test.io/pkgs/rollback-failing")
+	return nil, errors.New("installation failed")
+}
+
+func (s *failingInstaller) Delete(ctx context.Context, name string) error {
+	s.recorder.record("delete test.io/pkgs/rollback-failing")
+	return nil
+}
+
+type rollbackDependency struct {
+	pkgName string
+	size    int
+}
+
+// rollbackInstaller requests its dependencies one after another and records its merged parameter
+type rollbackInstaller struct {
+	pkgName      string
+	dependencies []rollbackDependency
+	recorder     *testRecorder
+}
+
+func (s *rollbackInstaller) Apply(ctx context.Context, name string, images map[string]landep.Image, helper *landep.InstallationHelper) (landep.Parameter, error) {
+	var parameter landep.Parameter
+	helper.MergedJsonParameter(&parameter, landep.WithConflictSolver(landep.MaximumConflictSolver))
+	dummy := struct{}{}
+	for _, d := range s.dependencies {
+		var options []landep.InstallationOption
+		if d.size > 0 {
+			options = append(options, landep.WithJsonParameter(map[string]int{"size": d.size}))
+		}
+		if helper.InstallationRequest(&dummy, d.pkgName, d.pkgName, ">= 1.0", options...).Error() != nil {
+			break
+		}
+	}
+	return helper.Apply(func() (interface{}, error) {
+		s.recorder.record("apply %s %s", s.pkgName, string(parameter))
+		return &dummy, nil
+	})
+}
+
+func (s *rollbackInstaller) Delete(ctx context.Context, name string) error {
+	s.recorder.record("delete %s", s.pkgName)
+	return nil
+}
+
+var _ = Describe("transactional apply", func() {
+	recorder := &testRecorder{}
+	register := func(pkgName string, dependencies ...rollbackDependency) {
+		landep.Repository.Register(pkgName, semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+			return &rollbackInstaller{pkgName: pkgName, dependencies: dependencies, recorder: recorder}, nil
+		})
+	}
+	register("test.io/pkgs/rollback-shared")
+	register("test.io/pkgs/rollback-new")
+	register("test.io/pkgs/rollback-existing", rollbackDependency{pkgName: "test.io/pkgs/rollback-shared", size: 1})
+	register("test.io/pkgs/rollback-root",
+		rollbackDependency{pkgName: "test.io/pkgs/rollback-new"},
+		rollbackDependency{pkgName: "test.io/pkgs/rollback-shared", size: 2},
+		rollbackDependency{pkgName: "test.io/pkgs/rollback-failing"})
+	landep.Repository.Register("test.io/pkgs/rollback-failing", semver.MustParse("1.0.0"), func(target landep.Target, version *semver.Version) (landep.Installer, error) {
+		return &failingInstaller{recorder: recorder}, nil
+	})
+
+	It("rolls back created and modified installations", func() {
+		pkgManager, err := landep.NewPackageManager(landep.Repository)
+		Expect(err).To(Succeed())
+		target := landep.NewK8sTarget("rollback", &landep.K8sConfig{URL: "https://gardener.canary.hana-ondemand.com"})
+		constraint, err := semver.NewConstraint(">= 1.0")
+		Expect(err).To(Succeed())
+		_, err = pkgManager.Apply(target, "test.io/pkgs/rollback-existing", constraint, nil)
+		Expect(err).To(Succeed())
+		recorder.reset()
+
+		_, err = pkgManager.Apply(target, "test.io/pkgs/rollback-root", constraint, nil)
+		Expect(err).To(HaveOccurred())
+		applyFailed, ok := err.(*landep.ApplyFailed)
+		Expect(ok).To(BeTrue())
+		Expect(applyFailed.Err.Error()).To(ContainSubstring("installation failed"))
+		Expect(applyFailed.Rollback.Deleted).To(ConsistOf(ContainSubstring("test.io/pkgs/rollback-new:1.0.0")))
+		Expect(applyFailed.Rollback.Restored).To(ConsistOf(ContainSubstring("test.io/pkgs/rollback-shared:1.0.0")))
+		Expect(applyFailed.Rollback.Failures).To(BeEmpty())
+		Expect(recorder.reset()).To(Equal([]string{
+			"apply test.io/pkgs/rollback-new ",
+			`apply test.io/pkgs/rollback-shared {"size":2}`,
+			"apply test.io/pkgs/rollback-failing",
+			"delete test.io/pkgs/rollback-new",
+			`apply test.io/pkgs/rollback-shared {"size":1}`,
+		}))
+
+		By("keeping only the previous requests", func() {
+			err = pkgManager.Delete(target, "test.io/pkgs/rollback-existing")
+			Expect(err).To(Succeed())
+			Expect(recorder.reset()).To(Equal([]string{
+				"delete test.io/pkgs/rollback-existing",
+				"delete test.io/pkgs/rollback-shared",
+			}))
+		})
+	})
+})
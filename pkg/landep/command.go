@@ -0,0 +1,122 @@
+package landep
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CommandRunner executes external commands like helm. It is injectable to test the targets without the real binaries.
+type CommandRunner interface {
+	Run(ctx context.Context, name string, args ...string) (stdout []byte, stderr []byte, err error)
+}
+
+// CommandRunnerFunc adapts a function to a CommandRunner
+type CommandRunnerFunc func(ctx context.Context, name string, args ...string) ([]byte, []byte, error)
+
+func (s CommandRunnerFunc) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	return s(ctx, name, args...)
+}
+
+var _ CommandRunner = CommandRunnerFunc(nil)
+
+// ExecCommandRunner executes commands found in PATH
+type ExecCommandRunner struct{}
+
+var _ CommandRunner = ExecCommandRunner{}
+
+func (s ExecCommandRunner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		exitCode := -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return stdout.Bytes(), stderr.Bytes(), &CommandError{
+			Command:  name,
+			Args:     args,
+			ExitCode: exitCode,
+			Stdout:   stdout.String(),
+			Stderr:   stderr.String(),
+			Err:      err,
+		}
+	}
+	return stdout.Bytes(), stderr.Bytes(), nil
+}
+
+// CommandError is returned if an external command fails. ExitCode is -1 if the command couldn't be started
+// or was killed.
+type CommandError struct {
+	Command  string
+	Args     []string
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	Err      error
+}
+
+func (d CommandError) Error() string {
+	message := strings.TrimSpace(d.Stderr)
+	if message == "" {
+		message = d.Err.Error()
+	}
+	return fmt.Sprintf("%s %s failed (exit code %d): %s", d.Command, strings.Join(d.Args, " "), d.ExitCode, message)
+}
+
+func (d CommandError) Unwrap() error {
+	return d.Err
+}
+
+var _ error = (*CommandError)(nil)
+
+// transientCommandMessages are contained in the output of helm and kapp for failures which are worth to be retried
+var transientCommandMessages = []string{
+	"another operation (install/upgrade/rollback) is in progress",
+	"connection refused",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"the server is currently unable to handle the request",
+}
+
+// transientCommandError marks failures of commands as Retryable if they are caused by transient problems
+func transientCommandError(err error) error {
+	var commandError *CommandError
+	if !errors.As(err, &commandError) {
+		return err
+	}
+	for _, message := range transientCommandMessages {
+		if strings.Contains(commandError.Stderr, message) {
+			return NewRetryable(err)
+		}
+	}
+	return err
+}
+
+// writeTempFile writes data into a new temporary file, which has to be removed by the caller
+func writeTempFile(pattern string, data []byte) (string, error) {
+	file, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,377 @@
+package landep
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// InstallationDrift lists the differences between an installation and the state of its target
+type InstallationDrift struct {
+	Digest      string             `json:"digest"`
+	PkgName     string             `json:"pkgName"`
+	Version     string             `json:"version"`
+	Target      *TargetDescription `json:"target"`
+	Differences []string           `json:"differences,omitempty"`
+	// Reconciled is set if the installation was reapplied
+	Reconciled bool `json:"reconciled,omitempty"`
+}
+
+func (s *InstallationDrift) Drifted() bool {
+	return len(s.Differences) != 0
+}
+
+// DriftReport lists all installations, children before their parents
+type DriftReport struct {
+	Installations []*InstallationDrift `json:"installations"`
+}
+
+// Drifted returns the installations which don't match their target
+func (s *DriftReport) Drifted() []*InstallationDrift {
+	var drifted []*InstallationDrift
+	for _, installation := range s.Installations {
+		if installation.Drifted() {
+			drifted = append(drifted, installation)
+		}
+	}
+	return drifted
+}
+
+func (s *DriftReport) String() string {
+	var sb strings.Builder
+	for i, installation := range s.Installations {
+		state := "in sync"
+		if installation.Reconciled {
+			state = "reconciled"
+		} else if installation.Drifted() {
+			state = "drifted"
+		}
+		sb.WriteString(fmt.Sprintf("%d. %s %s on %s %s\n", i+1, installation.PkgName, installation.Version, installation.Target, state))
+		for _, difference := range installation.Differences {
+			sb.WriteString(fmt.Sprintf("   %s\n", difference))
+		}
+	}
+	return sb.String()
+}
+
+// Diff compares all installations with the state of their targets. Installers are executed like in a plan,
+// but instead of recording the operations, the targets are queried whether they match.
+// Only helm releases, kapp apps, orgs, spaces and service brokers are checked.
+func (s *PackageManager) Diff() (*DriftReport, error) {
+	return s.DiffContext(context.Background())
+}
+
+func (s *PackageManager) DiffContext(ctx context.Context) (*DriftReport, error) {
+	report, err := s.detectDrift(ctx, false)
+	return report, s.redactor.RedactError(err)
+}
+
+// Reconcile reapplies all drifted installations in dependency order. Changed responses are
+// propagated to the dependents afterwards.
+func (s *PackageManager) Reconcile() (*DriftReport, error) {
+	return s.ReconcileContext(context.Background())
+}
+
+func (s *PackageManager) ReconcileContext(ctx context.Context) (*DriftReport, error) {
+	report, err := s.detectDrift(ctx, true)
+	if err == nil {
+		err = s.propagate(ctx, nil)
+	}
+	return report, s.redactor.RedactError(err)
+}
+
+func (s *PackageManager) detectDrift(ctx context.Context, reconcile bool) (*DriftReport, error) {
+	report := &DriftReport{}
+	for _, installation := range s.topologicalOrder() {
+		drift, err := s.drift(ctx, installation)
+		if err != nil {
+			return nil, err
+		}
+		report.Installations = append(report.Installations, drift)
+		if reconcile && drift.Drifted() {
+			err = s.reapply(ctx, installation)
+			if err != nil {
+				return nil, fmt.Errorf("reconciliation of %s failed: %w", describeInstallation(installation), err)
+			}
+			drift.Reconciled = true
+		}
+	}
+	return report, nil
+}
+
+// drift executes the installer of the installed version against drift detecting targets
+func (s *PackageManager) drift(ctx context.Context, installation *Installation) (*InstallationDrift, error) {
+	unlock := s.lock(installation.Digest)
+	defer unlock()
+	drift := &InstallationDrift{
+		Digest:  installation.Digest,
+		PkgName: installation.PkgName,
+		Version: installation.Version.String(),
+		Target:  installation.Target.Description(),
+	}
+	installerFactory, err := s.repository.getVersion(installation.PkgName, installation.Version)
+	if err != nil {
+		return nil, err
+	}
+	target, err := newDriftTarget(installation.Target, func(difference string) {
+		drift.Differences = append(drift.Differences, s.redactor.Redact(difference))
+	})
+	if err != nil {
+		return nil, err
+	}
+	installer, err := installerFactory(target, installation.Version)
+	if err != nil {
+		return nil, err
+	}
+	s.redactor.registerInstallation(installation)
+	for {
+		err = s.invoke(ctx, installation, func(ctx context.Context) error {
+			drift.Differences = nil
+			helper := NewDependencyChecker(installation.parameters(), installation.Responses)
+			_, err := installer.Apply(ctx, installation.Digest, nil, helper)
+			return err
+		})
+		if err == nil {
+			return drift, nil
+		}
+		dependenciesMissing, ok := err.(*DependenciesMissing)
+		if !ok {
+			if _, ok := err.(*Interrupted); ok {
+				return nil, err
+			}
+			return nil, fmt.Errorf("drift detection of %s failed: %w", describeInstallation(installation), err)
+		}
+		names := make([]string, 0, len(dependenciesMissing.DependencyRequests))
+		for name := range dependenciesMissing.DependencyRequests {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		// secrets aren't persisted and therefore missing after a restart
+		for _, name := range names {
+			request := dependenciesMissing.DependencyRequests[name]
+			if request.Secret == nil {
+				drift.Differences = append(drift.Differences, fmt.Sprintf("dependency %s isn't installed", name))
+				continue
+			}
+			err = s.resolveSecret(ctx, installation, name, request.Secret)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if drift.Drifted() {
+			return drift, nil
+		}
+	}
+}
+
+// reapply executes the installer of a drifted installation again
+func (s *PackageManager) reapply(ctx context.Context, installation *Installation) error {
+	unlock := s.lock(installation.Digest)
+	defer unlock()
+	installer, err := s.installedInstaller(installation)
+	if err != nil {
+		return err
+	}
+	err = s.run(ctx, installation, installer, nil)
+	if err != nil {
+		return err
+	}
+	return s.save(installation)
+}
+
+// newDriftTarget wraps a target so that the operations of an installer are compared with
+// the state of the target instead of being executed. Differences are passed to report.
+func newDriftTarget(target Target, report func(difference string)) (Target, error) {
+	switch t := target.(type) {
+	case K8sCloudFoundryBridgingTarget:
+		return &k8sCloudFoundryBridgingTarget{
+			k8sTarget:          &k8sTargetDrift{K8sTarget: t.K8sTarget(), report: report},
+			cloudFoundryTarget: &cloudFoundryTargetDrift{CloudFoundryTarget: t.CloudFoundryTarget(), report: report},
+		}, nil
+	case K8sTarget:
+		return &k8sTargetDrift{K8sTarget: t, report: report}, nil
+	case CloudFoundryTarget:
+		return &cloudFoundryTargetDrift{CloudFoundryTarget: t, report: report}, nil
+	}
+	return nil, fmt.Errorf("drift of target %T can't be detected", target)
+}
+
+type k8sTargetDrift struct {
+	K8sTarget
+	report func(difference string)
+}
+
+func (s *k8sTargetDrift) Helm() Helm {
+	return &helmDrift{Helm: s.K8sTarget.Helm(), report: s.report}
+}
+
+func (s *k8sTargetDrift) Kapp() Kapp {
+	return &kappDrift{Kapp: s.K8sTarget.Kapp(), report: s.report}
+}
+
+// Manifests aren't checked
+func (s *k8sTargetDrift) Manifests() Manifests {
+	return &manifestsDrift{}
+}
+
+func (s *k8sTargetDrift) EnsureNamespace(ctx context.Context, installation string) error {
+	return nil
+}
+
+func (s *k8sTargetDrift) DeleteNamespace(ctx context.Context) error {
+	return nil
+}
+
+type helmDrift struct {
+	Helm
+	report func(difference string)
+}
+
+func (s *helmDrift) Apply(ctx context.Context, name string, chart string, version *semver.Version, parameter json.RawMessage) error {
+	status, err := s.Status(ctx, name)
+	if _, ok := err.(*ReleaseNotFound); ok {
+		s.report(fmt.Sprintf("helm release %s is missing", name))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// the chart might be prefixed with the helm repository
+	if status.Chart != path.Base(chart) || status.ChartVersion != version.String() {
+		s.report(fmt.Sprintf("helm release %s has chart %s %s instead of %s %s", name, status.Chart, status.ChartVersion, path.Base(chart), version.String()))
+	}
+	if !status.Deployed() {
+		s.report(fmt.Sprintf("helm release %s is %s", name, status.Status))
+	}
+	values, err := s.GetValues(ctx, name)
+	if err != nil {
+		return err
+	}
+	if len(parameter) == 0 {
+		parameter = json.RawMessage("{}")
+	}
+	if !JsonEqual(values, parameter) {
+		s.report(fmt.Sprintf("values of helm release %s differ: %s instead of %s", name, string(values), string(parameter)))
+	}
+	return nil
+}
+
+func (s *helmDrift) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+func (s *helmDrift) Rollback(ctx context.Context, name string, revision int) error {
+	return nil
+}
+
+type kappDrift struct {
+	Kapp
+	report func(difference string)
+}
+
+// Apply checks that the app exists and is reconciled. kapp doesn't keep the version and the values of an app.
+func (s *kappDrift) Apply(ctx context.Context, name string, chart string, version *semver.Version, parameter json.RawMessage) error {
+	status, err := s.Status(ctx, name)
+	if _, ok := err.(*KappAppNotFound); ok {
+		s.report(fmt.Sprintf("kapp app %s is missing", name))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(status.Failing) != 0 {
+		s.report(fmt.Sprintf("resources of kapp app %s aren't reconciled: %s", name, strings.Join(status.Failing, ", ")))
+	}
+	return nil
+}
+
+func (s *kappDrift) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+type manifestsDrift struct{}
+
+func (s *manifestsDrift) Apply(ctx context.Context, name string, data []byte) error {
+	return nil
+}
+
+func (s *manifestsDrift) ApplyKustomization(ctx context.Context, name string, directory string) error {
+	return nil
+}
+
+func (s *manifestsDrift) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+// cloudFoundryTargetDrift checks orgs, spaces and service brokers. Quotas, roles and service access
+// are only set and therefore not checked.
+type cloudFoundryTargetDrift struct {
+	CloudFoundryTarget
+	report func(difference string)
+}
+
+func (s *cloudFoundryTargetDrift) CreateOrg(ctx context.Context, name string, user string) error {
+	exists, err := s.OrgExists(ctx, name)
+	if err == nil && !exists {
+		s.report(fmt.Sprintf("organization %s is missing", name))
+	}
+	return err
+}
+
+func (s *cloudFoundryTargetDrift) DeleteOrg(ctx context.Context, name string) error {
+	return nil
+}
+
+func (s *cloudFoundryTargetDrift) CreateSpace(ctx context.Context, org string, name string) error {
+	exists, err := s.SpaceExists(ctx, org, name)
+	if err == nil && !exists {
+		s.report(fmt.Sprintf("space %s is missing in organization %s", name, org))
+	}
+	return err
+}
+
+func (s *cloudFoundryTargetDrift) DeleteSpace(ctx context.Context, name string) error {
+	return nil
+}
+
+func (s *cloudFoundryTargetDrift) SetOrgQuota(ctx context.Context, org string, quota CloudFoundryQuota) error {
+	return nil
+}
+
+func (s *cloudFoundryTargetDrift) SetSpaceQuota(ctx context.Context, org string, space string, quota CloudFoundryQuota) error {
+	return nil
+}
+
+func (s *cloudFoundryTargetDrift) AssignOrgRole(ctx context.Context, org string, user string, role CloudFoundryRole) error {
+	return nil
+}
+
+func (s *cloudFoundryTargetDrift) AssignSpaceRole(ctx context.Context, org string, space string, user string, role CloudFoundryRole) error {
+	return nil
+}
+
+func (s *cloudFoundryTargetDrift) RegisterServiceBroker(ctx context.Context, broker ServiceBroker) error {
+	url, err := s.ServiceBrokerURL(ctx, broker.Name)
+	if err != nil {
+		return err
+	}
+	if url == "" {
+		s.report(fmt.Sprintf("service broker %s is missing", broker.Name))
+	} else if url != broker.URL {
+		s.report(fmt.Sprintf("service broker %s has url %s instead of %s", broker.Name, url, broker.URL))
+	}
+	return nil
+}
+
+func (s *cloudFoundryTargetDrift) DeleteServiceBroker(ctx context.Context, name string) error {
+	return nil
+}
+
+func (s *cloudFoundryTargetDrift) EnableServiceAccess(ctx context.Context, broker string, orgs []string) error {
+	return nil
+}
@@ -1,6 +1,8 @@
 package landep
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -26,3 +28,147 @@ func (d DependenciesMissing) Error() string {
 }
 
 var _ error = (*DependenciesMissing)(nil)
+
+// DependencyChainEntry describes an installation requested while resolving dependencies
+type DependencyChainEntry struct {
+	PkgName   string             `json:"pkgName"`
+	Target    *TargetDescription `json:"target"`
+	Requester string             `json:"requester"`
+	digest    string
+}
+
+// DependencyCycle is returned if an installation (transitively) requests itself.
+// Chain starts and ends with the same installation.
+type DependencyCycle struct {
+	Chain []DependencyChainEntry
+}
+
+func (d DependencyCycle) Error() string {
+	var sb strings.Builder
+	sb.WriteString("dependency cycle detected: ")
+	for i, entry := range d.Chain {
+		if i > 0 {
+			sb.WriteString(" -> ")
+		}
+		sb.WriteString(fmt.Sprintf("%s on %s requested by %s", entry.PkgName, entry.Target, entry.Requester))
+	}
+	return sb.String()
+}
+
+var _ error = (*DependencyCycle)(nil)
+
+// Interrupted is returned if the application or deletion of an installation was cancelled or timed out
+type Interrupted struct {
+	PkgName string
+	Target  *TargetDescription
+	Digest  string
+	Err     error
+}
+
+func (d Interrupted) Error() string {
+	return fmt.Sprintf("installation %s on %s interrupted: %v", d.PkgName, d.Target, d.Err)
+}
+
+func (d Interrupted) Unwrap() error {
+	return d.Err
+}
+
+var _ error = (*Interrupted)(nil)
+
+// ReleaseNotFound is returned by the queries of Helm if the release doesn't exist
+type ReleaseNotFound struct {
+	Name      string
+	Namespace string
+}
+
+func (d ReleaseNotFound) Error() string {
+	return fmt.Sprintf("release %s not found in namespace %s", d.Name, d.Namespace)
+}
+
+var _ error = (*ReleaseNotFound)(nil)
+
+// KappAppNotFound is returned by Kapp.Status if the app doesn't exist
+type KappAppNotFound struct {
+	Name      string
+	Namespace string
+}
+
+func (d KappAppNotFound) Error() string {
+	return fmt.Sprintf("kapp app %s not found in namespace %s", d.Name, d.Namespace)
+}
+
+var _ error = (*KappAppNotFound)(nil)
+
+// Retryable marks an error of an installer or target as transient. Installer invocations failing
+// with a Retryable error are retried according to the RetryPolicy of the PackageManager.
+type Retryable struct {
+	Err error
+}
+
+func (d Retryable) Error() string {
+	return d.Err.Error()
+}
+
+func (d Retryable) Unwrap() error {
+	return d.Err
+}
+
+var _ error = (*Retryable)(nil)
+
+// NewRetryable marks err as transient
+func NewRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Retryable{Err: err}
+}
+
+// IsRetryable returns true if err or one of the errors it wraps is Retryable
+func IsRetryable(err error) bool {
+	var retryable *Retryable
+	return errors.As(err, &retryable)
+}
+
+// FailedAttempts is returned if an installer invocation failed after more than one attempt
+type FailedAttempts struct {
+	Attempts int
+	Err      error
+}
+
+func (d FailedAttempts) Error() string {
+	return fmt.Sprintf("failed after %d attempts: %v", d.Attempts, d.Err)
+}
+
+func (d FailedAttempts) Unwrap() error {
+	return d.Err
+}
+
+var _ error = (*FailedAttempts)(nil)
+
+// SecretNotFound is returned if a SecretResolver doesn't know a requested secret
+type SecretNotFound struct {
+	Name   string
+	Source string
+}
+
+func (d SecretNotFound) Error() string {
+	return fmt.Sprintf("secret %s not found in %s", d.Name, d.Source)
+}
+
+var _ error = (*SecretNotFound)(nil)
+
+// RedactedError hides sensitive values contained in the message of Err
+type RedactedError struct {
+	message string
+	Err     error
+}
+
+func (d RedactedError) Error() string {
+	return d.message
+}
+
+func (d RedactedError) Unwrap() error {
+	return d.Err
+}
+
+var _ error = (*RedactedError)(nil)
@@ -0,0 +1,205 @@
+package landep
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GraphNode is an installation. Shared installations have more than one requester.
+type GraphNode struct {
+	Digest     string             `json:"digest"`
+	PkgName    string             `json:"pkgName"`
+	Version    string             `json:"version"`
+	Target     *TargetDescription `json:"target"`
+	Requesters []string           `json:"requesters"`
+}
+
+func (s *GraphNode) Shared() bool {
+	return len(s.Requesters) > 1
+}
+
+// GraphEdge points from an installation to a child requested under Name
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Name string `json:"name"`
+}
+
+// Graph is the dependency graph of all installations known to a PackageManager
+type Graph struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+}
+
+// Graph returns the dependency graph of all installations. Requesters are given by their package name,
+// the package manager itself by "package-manager".
+func (s *PackageManager) Graph() *Graph {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	graph := &Graph{}
+	for _, installation := range s.installationsByDigest {
+		node := &GraphNode{Digest: installation.Digest, PkgName: installation.PkgName, Target: installation.Target.Description()}
+		if installation.Version != nil {
+			node.Version = installation.Version.String()
+		}
+		for requester := range installation.Requests {
+			node.Requesters = append(node.Requesters, s.requesterPkgName(requester))
+		}
+		sort.Strings(node.Requesters)
+		graph.Nodes = append(graph.Nodes, node)
+		for _, child := range installation.Children {
+			graph.Edges = append(graph.Edges, &GraphEdge{From: installation.Digest, To: child.Installation.Digest, Name: child.Name})
+		}
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		if graph.Nodes[i].PkgName != graph.Nodes[j].PkgName {
+			return graph.Nodes[i].PkgName < graph.Nodes[j].PkgName
+		}
+		return graph.Nodes[i].Digest < graph.Nodes[j].Digest
+	})
+	sort.SliceStable(graph.Edges, func(i, j int) bool {
+		return graph.Edges[i].From < graph.Edges[j].From
+	})
+	return graph
+}
+
+// requesterPkgName maps the name of a requesting installation to its package name
+func (s *PackageManager) requesterPkgName(requester string) string {
+	index := strings.LastIndex(requester, "/")
+	if index < 0 {
+		return requester
+	}
+	if installation, ok := s.installationsByDigest[requester[index+1:]]; ok {
+		return installation.PkgName
+	}
+	return requester
+}
+
+func (s *GraphNode) label(separator string, quote *strings.Replacer) string {
+	label := []string{s.PkgName, s.Version, s.Target.String()}
+	if s.Shared() {
+		label = append(label, "shared by "+strings.Join(s.Requesters, ", "))
+	}
+	for i := range label {
+		label[i] = quote.Replace(label[i])
+	}
+	return strings.Join(label, separator)
+}
+
+// DOT renders the graph in the Graphviz DOT language
+func (s *Graph) DOT() string {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	var sb strings.Builder
+	sb.WriteString("digraph landep {\n")
+	sb.WriteString("  node [shape=box];\n")
+	for _, node := range s.Nodes {
+		attributes := ""
+		if node.Shared() {
+			attributes = `, style="bold,filled", fillcolor=lightyellow`
+		}
+		sb.WriteString(fmt.Sprintf("  \"%s\" [label=\"%s\"%s];\n", node.Digest, node.label(`\n`, quote), attributes))
+	}
+	for _, edge := range s.Edges {
+		sb.WriteString(fmt.Sprintf("  \"%s\" -> \"%s\" [label=\"%s\"];\n", edge.From, edge.To, quote.Replace(edge.Name)))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Mermaid renders the graph as Mermaid flowchart
+func (s *Graph) Mermaid() string {
+	quote := strings.NewReplacer(`"`, "#quot;")
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+	var shared []string
+	for _, node := range s.Nodes {
+		sb.WriteString(fmt.Sprintf("  n%s[\"%s\"]\n", node.Digest, node.label("<br/>", quote)))
+		if node.Shared() {
+			shared = append(shared, "n"+node.Digest)
+		}
+	}
+	for _, edge := range s.Edges {
+		sb.WriteString(fmt.Sprintf("  n%s -->|\"%s\"| n%s\n", edge.From, quote.Replace(edge.Name), edge.To))
+	}
+	if len(shared) > 0 {
+		sb.WriteString("  classDef shared fill:#ffffe0,stroke-width:3px\n")
+		sb.WriteString(fmt.Sprintf("  class %s shared\n", strings.Join(shared, ",")))
+	}
+	return sb.String()
+}
+
+// TreeNode is an installation with its children. Name is the name under which it was requested
+// by its parent and empty for installations requested by the package manager itself.
+type TreeNode struct {
+	Name     string             `json:"name,omitempty"`
+	Digest   string             `json:"digest"`
+	PkgName  string             `json:"pkgName"`
+	Version  string             `json:"version"`
+	Target   *TargetDescription `json:"target"`
+	Shared   bool               `json:"shared,omitempty"`
+	Children []*TreeNode        `json:"children,omitempty"`
+}
+
+// Tree contains the installations requested by the package manager itself
+type Tree []*TreeNode
+
+// Tree returns the installations requested by the package manager itself together with
+// their (transitive) children. Shared installations appear below each of their requesters.
+func (s *Graph) Tree() Tree {
+	nodes := make(map[string]*GraphNode, len(s.Nodes))
+	for _, node := range s.Nodes {
+		nodes[node.Digest] = node
+	}
+	edges := make(map[string][]*GraphEdge)
+	for _, edge := range s.Edges {
+		edges[edge.From] = append(edges[edge.From], edge)
+	}
+	var tree func(name string, node *GraphNode) *TreeNode
+	tree = func(name string, node *GraphNode) *TreeNode {
+		result := &TreeNode{Name: name, Digest: node.Digest, PkgName: node.PkgName, Version: node.Version, Target: node.Target, Shared: node.Shared()}
+		for _, edge := range edges[node.Digest] {
+			if child, ok := nodes[edge.To]; ok {
+				result.Children = append(result.Children, tree(edge.Name, child))
+			}
+		}
+		return result
+	}
+	var result Tree
+	for _, node := range s.Nodes {
+		for _, requester := range node.Requesters {
+			if requester == packageManagerRequester {
+				result = append(result, tree("", node))
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (s Tree) String() string {
+	var sb strings.Builder
+	var write func(node *TreeNode, prefix string, childPrefix string)
+	write = func(node *TreeNode, prefix string, childPrefix string) {
+		sb.WriteString(prefix)
+		if node.Name != "" {
+			sb.WriteString(node.Name + ": ")
+		}
+		sb.WriteString(fmt.Sprintf("%s %s %s", node.PkgName, node.Version, node.Target))
+		if node.Shared {
+			sb.WriteString(" (shared)")
+		}
+		sb.WriteString("\n")
+		for i, child := range node.Children {
+			if i == len(node.Children)-1 {
+				write(child, childPrefix+"└── ", childPrefix+"    ")
+			} else {
+				write(child, childPrefix+"├── ", childPrefix+"│   ")
+			}
+		}
+	}
+	for _, node := range s {
+		write(node, "", "")
+	}
+	return sb.String()
+}
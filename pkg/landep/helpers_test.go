@@ -0,0 +1,40 @@
+package landep
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/gomega"
+)
+
+// fakeExecutables puts shell scripts on PATH. Each script appends its arguments to <name>.log in dir.
+type fakeExecutables struct {
+	dir  string
+	path string
+}
+
+func newFakeExecutables(scripts map[string]string) *fakeExecutables {
+	dir, err := ioutil.TempDir("", "landep-executables")
+	Expect(err).To(Succeed())
+	for name, script := range scripts {
+		Expect(ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0700)).To(Succeed())
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	os.Setenv("FAKE_LOG_DIR", dir)
+	return &fakeExecutables{dir: dir, path: path}
+}
+
+func (s *fakeExecutables) log(name string) []string {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, name+".log"))
+	Expect(err).To(Succeed())
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func (s *fakeExecutables) cleanup() {
+	os.Setenv("PATH", s.path)
+	os.Unsetenv("FAKE_LOG_DIR")
+	os.RemoveAll(s.dir)
+}
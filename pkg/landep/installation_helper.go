@@ -10,6 +10,7 @@ type InstallationHelper struct {
 	requestedDependencies map[string]DependencyRequest
 	responses             map[string]Response
 	parameter             []Parameter
+	mergedParameter       Parameter
 	err                   error
 }
 
@@ -103,6 +104,7 @@ func (s *InstallationHelper) MergedJsonParameter(parameter *Parameter, options .
 		return s
 	}
 	(*parameter), s.err = JsonMerge(s.parameter, options...)
+	s.mergedParameter = *parameter
 	return s
 }
 
@@ -115,6 +117,7 @@ func (s *InstallationHelper) MergedParameter(parameter interface{}, options ...J
 		s.err = err
 		return s
 	}
+	s.mergedParameter = parameterJson
 	if parameterJson != nil {
 		s.err = json.Unmarshal(parameterJson, parameter)
 		if s.err != nil {
@@ -1,8 +1,9 @@
 package landep
 
 import (
+	"context"
 	"encoding/json"
-	"strings"
+	"sort"
 
 	"github.com/Masterminds/semver/v3"
 )
@@ -18,45 +19,42 @@ type Response = json.RawMessage
 
 type Secret = json.RawMessage
 
-type IntersectedConstrains []*semver.Constraints
-
-func (s IntersectedConstrains) Check(version *semver.Version) bool {
-	for _, c := range s {
-		if !c.Check(version) {
-			return false
-		}
-	}
-	return true
-}
-
-func (s IntersectedConstrains) String() string {
-	sb := strings.Builder{}
-	for i, c := range s {
-		if i > 0 {
-			sb.WriteString(" and ")
-		}
-		sb.WriteString(c.String())
-	}
-	return sb.String()
-}
-
 type Installation struct {
 	Response  Parameter                      `json:"-"`
+	Parameter Parameter                      `json:"-"`
 	Version   *semver.Version                `json:"version"`
 	Requests  map[string]InstallationRequest `json:"-"`
 	PkgName   string                         `json:"pkgName"`
 	Target    Target                         `json:"-"`
 	Digest    string                         `json:"-"`
-	Children  []*Installation                `json:"-"`
+	Children  []*Child                       `json:"-"`
 	Responses map[string]Response            `json:"-"`
+	// secrets contains the names of the responses which are resolved secrets. They aren't persisted.
+	secrets map[string]struct{}
+}
+
+// Child is an installation requested by another installation under the given name.
+// Children of the same stage were requested together and therefore don't depend on each other.
+type Child struct {
+	Name         string
+	Stage        int
+	Installation *Installation
 }
 
-func (s *Installation) IntersectedConstraints() IntersectedConstrains {
-	intersectedConstraints := []*semver.Constraints{}
-	for _, r := range s.Requests {
-		intersectedConstraints = append(intersectedConstraints, r.Constraints)
+// parameters returns the parameters of all requests ordered by requester
+func (s *Installation) parameters() []Parameter {
+	requesters := make([]string, 0, len(s.Requests))
+	for requester := range s.Requests {
+		requesters = append(requesters, requester)
 	}
-	return intersectedConstraints
+	sort.Strings(requesters)
+	parameters := []Parameter{}
+	for _, requester := range requesters {
+		if s.Requests[requester].Parameter != nil {
+			parameters = append(parameters, s.Requests[requester].Parameter)
+		}
+	}
+	return parameters
 }
 
 type InstallationRequest struct {
@@ -76,8 +74,45 @@ type DependencyRequest struct {
 }
 
 type Installer interface {
+	Apply(ctx context.Context, name string, images map[string]Image, helper *InstallationHelper) (Parameter, error)
+	Delete(ctx context.Context, name string) error
+}
+
+type InstallerFactory = func(target Target, version *semver.Version) (Installer, error)
+
+// LegacyInstaller is an installer which isn't aware of contexts
+type LegacyInstaller interface {
 	Apply(name string, images map[string]Image, helper *InstallationHelper) (Parameter, error)
 	Delete(name string) error
 }
 
-type InstallerFactory = func(target Target, version *semver.Version) (Installer, error)
+type LegacyInstallerFactory = func(target Target, version *semver.Version) (LegacyInstaller, error)
+
+type legacyInstallerAdapter struct {
+	installer LegacyInstaller
+}
+
+func (s *legacyInstallerAdapter) Apply(ctx context.Context, name string, images map[string]Image, helper *InstallationHelper) (Parameter, error) {
+	return s.installer.Apply(name, images, helper)
+}
+
+func (s *legacyInstallerAdapter) Delete(ctx context.Context, name string) error {
+	return s.installer.Delete(name)
+}
+
+// AdaptLegacyInstaller adapts an installer which isn't aware of contexts. Such an installer can't be
+// interrupted, the package manager only stops before and after its invocation.
+func AdaptLegacyInstaller(installer LegacyInstaller) Installer {
+	return &legacyInstallerAdapter{installer: installer}
+}
+
+// AdaptLegacyInstallerFactory adapts a factory of installers which aren't aware of contexts
+func AdaptLegacyInstallerFactory(factory LegacyInstallerFactory) InstallerFactory {
+	return func(target Target, version *semver.Version) (Installer, error) {
+		installer, err := factory(target, version)
+		if err != nil {
+			return nil, err
+		}
+		return AdaptLegacyInstaller(installer), nil
+	}
+}
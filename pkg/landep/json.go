@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"regexp"
+
+	"gopkg.in/yaml.v2"
 )
 
 func defaultConflictSolver(path string, j1 json.RawMessage, j2 json.RawMessage) (json.RawMessage, error) {
@@ -28,6 +31,11 @@ func MaximumConflictSolver(path string, j1 json.RawMessage, j2 json.RawMessage)
 	return json.Marshal(&i1)
 }
 
+// LastWinsConflictSolver resolves conflicts in favour of the json merged last
+func LastWinsConflictSolver(path string, j1 json.RawMessage, j2 json.RawMessage) (json.RawMessage, error) {
+	return j2, nil
+}
+
 type JsonMergeOptions struct {
 	conflictSolver func(path string, j1 json.RawMessage, j2 json.RawMessage) (json.RawMessage, error)
 }
@@ -97,6 +105,19 @@ func jsonMerge(jsons []json.RawMessage, path string, conflictSolver func(path st
 	return result, nil
 }
 
+// JsonEqual compares two jsons semantically
+func JsonEqual(j1 json.RawMessage, j2 json.RawMessage) bool {
+	if len(j1) == 0 || len(j2) == 0 {
+		return len(j1) == len(j2)
+	}
+	var v1 interface{}
+	var v2 interface{}
+	if json.Unmarshal(j1, &v1) != nil || json.Unmarshal(j2, &v2) != nil {
+		return bytes.Equal(j1, j2)
+	}
+	return reflect.DeepEqual(v1, v2)
+}
+
 var objectRegexp = regexp.MustCompile("^\\s*\\{")
 
 func JsonMappify(i json.RawMessage) (map[string]json.RawMessage, bool, error) {
@@ -110,3 +131,49 @@ func JsonMappify(i json.RawMessage) (map[string]json.RawMessage, bool, error) {
 	}
 	return nil, false, nil
 }
+
+// YamlToJson converts a YAML document (or a JSON document, which is YAML, too) into JSON
+func YamlToJson(data []byte) (json.RawMessage, error) {
+	var value interface{}
+	err := yaml.Unmarshal(data, &value)
+	if err != nil {
+		return nil, err
+	}
+	value, err = jsonCompatible(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// jsonCompatible converts the maps created by the YAML decoder into maps with string keys
+func jsonCompatible(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported key %v", key)
+			}
+			converted, err := jsonCompatible(value)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = converted
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, value := range v {
+			converted, err := jsonCompatible(value)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = converted
+		}
+		return result, nil
+	default:
+		return value, nil
+	}
+}
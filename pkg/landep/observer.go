@@ -0,0 +1,181 @@
+package landep
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// EventInstallation identifies the installation an event refers to. Version is empty
+// as long as no version was selected.
+type EventInstallation struct {
+	Digest  string
+	PkgName string
+	Version string
+	Target  *TargetDescription
+}
+
+func (s EventInstallation) Installation() EventInstallation {
+	return s
+}
+
+func (s EventInstallation) String() string {
+	if s.Version == "" {
+		return fmt.Sprintf("%s on %s", s.PkgName, s.Target)
+	}
+	return fmt.Sprintf("%s:%s on %s", s.PkgName, s.Version, s.Target)
+}
+
+// Event is one of ResolutionStarted, VersionSelected, DependencyRequested, InstallerApplied,
+// InstallerDeleted, Failed and Skipped
+type Event interface {
+	Installation() EventInstallation
+	String() string
+}
+
+// ResolutionStarted is sent when an installation is requested
+type ResolutionStarted struct {
+	EventInstallation
+	Requester   string
+	Constraints string
+}
+
+func (s *ResolutionStarted) String() string {
+	return fmt.Sprintf("resolving %s (%s) requested by %s", s.EventInstallation, s.Constraints, s.Requester)
+}
+
+// VersionSelected is sent when the version satisfying all requests was selected. Previous is
+// the version installed before, if any.
+type VersionSelected struct {
+	EventInstallation
+	Previous string
+}
+
+func (s *VersionSelected) String() string {
+	if s.Previous == "" {
+		return fmt.Sprintf("selected %s", s.EventInstallation)
+	}
+	return fmt.Sprintf("selected %s (previously %s)", s.EventInstallation, s.Previous)
+}
+
+// DependencyRequested is sent for each installation requested by an installer
+type DependencyRequested struct {
+	EventInstallation
+	Name       string
+	Dependency string
+	// DependencyTarget is the target of the requested installation
+	DependencyTarget *TargetDescription
+}
+
+func (s *DependencyRequested) String() string {
+	return fmt.Sprintf("%s requested %s as %s on %s", s.EventInstallation, s.Dependency, s.Name, s.DependencyTarget)
+}
+
+// InstallerApplied is sent after the installer was applied successfully with all its dependencies
+type InstallerApplied struct {
+	EventInstallation
+	Attempts int
+}
+
+func (s *InstallerApplied) String() string {
+	return fmt.Sprintf("applied %s (%s)", s.EventInstallation, attemptsString(s.Attempts))
+}
+
+// InstallerDeleted is sent after the installer deleted the installation
+type InstallerDeleted struct {
+	EventInstallation
+	Attempts int
+}
+
+func (s *InstallerDeleted) String() string {
+	return fmt.Sprintf("deleted %s (%s)", s.EventInstallation, attemptsString(s.Attempts))
+}
+
+// Failed is sent if the resolution or an invocation of the installer failed. Attempts is 0 if the
+// installer wasn't invoked. Err is redacted.
+type Failed struct {
+	EventInstallation
+	Err      error
+	Attempts int
+}
+
+func (s *Failed) String() string {
+	if s.Attempts == 0 {
+		return fmt.Sprintf("failed %s: %v", s.EventInstallation, s.Err)
+	}
+	return fmt.Sprintf("failed %s (%s): %v", s.EventInstallation, attemptsString(s.Attempts), s.Err)
+}
+
+// Skipped is sent if an installation isn't applied because nothing changed
+type Skipped struct {
+	EventInstallation
+	Reason string
+}
+
+func (s *Skipped) String() string {
+	return fmt.Sprintf("skipped %s: %s", s.EventInstallation, s.Reason)
+}
+
+func attemptsString(attempts int) string {
+	if attempts == 1 {
+		return "1 attempt"
+	}
+	return fmt.Sprintf("%d attempts", attempts)
+}
+
+// Observer receives the events of a PackageManager. The events are delivered one after another,
+// also if installers are executed concurrently. Observers must not call the PackageManager.
+type Observer interface {
+	Observe(event Event)
+}
+
+// ObserverFunc adapts a function to an Observer
+type ObserverFunc func(event Event)
+
+func (f ObserverFunc) Observe(event Event) {
+	f(event)
+}
+
+// WithObserver registers an observer. Observers are notified in the order of their registration.
+func WithObserver(observer Observer) PackageManagerOption {
+	return func(pm *PackageManager) error {
+		pm.observers = append(pm.observers, observer)
+		return nil
+	}
+}
+
+func (s *PackageManager) notify(event Event) {
+	if len(s.observers) == 0 {
+		return
+	}
+	s.observersMutex.Lock()
+	defer s.observersMutex.Unlock()
+	for _, observer := range s.observers {
+		observer.Observe(event)
+	}
+}
+
+func eventInstallation(installation *Installation) EventInstallation {
+	event := EventInstallation{
+		Digest:  installation.Digest,
+		PkgName: installation.PkgName,
+		Target:  installation.Target.Description(),
+	}
+	if installation.Version != nil {
+		event.Version = installation.Version.String()
+	}
+	return event
+}
+
+func (s *PackageManager) notifyVersionSelected(installation *Installation, version *semver.Version) {
+	event := &VersionSelected{EventInstallation: eventInstallation(installation)}
+	event.Version = version.String()
+	if installation.Version != nil {
+		event.Previous = installation.Version.String()
+	}
+	s.notify(event)
+}
+
+func (s *PackageManager) notifyFailed(installation *Installation, err error, attempts int) {
+	s.notify(&Failed{EventInstallation: eventInstallation(installation), Err: s.redactor.RedactError(err), Attempts: attempts})
+}
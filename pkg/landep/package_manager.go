@@ -2,33 +2,432 @@ package landep
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
-	"os"
+	"sort"
+	"sync"
+	"time"
 
 	semver "github.com/Masterminds/semver/v3"
 )
 
 type PackageManager struct {
 	repository            repository
+	stateStore            StateStore
 	installationsByDigest map[string]*Installation
+	plan                  *Plan
+	workers               chan struct{}
+	installationTimeout   time.Duration
+	retryPolicy           RetryPolicy
+	secretResolver        SecretResolver
+	redactor              *Redactor
+	mutex                 sync.Mutex
+	locks                 map[string]*sync.Mutex
+	requests              map[string][]DependencyChainEntry
+	installing            map[string]int
+	observers             []Observer
+	observersMutex        sync.Mutex
 }
 
-func NewPackageManager(repository repository) *PackageManager {
-	return &PackageManager{repository: repository}
+type PackageManagerOption = func(pm *PackageManager) error
+
+// WithStateStore persists all installations in the given store. Installations
+// found in the store are loaded by NewPackageManager.
+func WithStateStore(stateStore StateStore) PackageManagerOption {
+	return func(pm *PackageManager) error {
+		pm.stateStore = stateStore
+		return nil
+	}
+}
+
+// WithWorkers limits the number of installers executed concurrently. Independent dependencies
+// are applied and deleted in parallel if more than one worker is configured. Default is 1.
+func WithWorkers(workers int) PackageManagerOption {
+	return func(pm *PackageManager) error {
+		if workers < 1 {
+			return fmt.Errorf("invalid number of workers %d", workers)
+		}
+		pm.workers = make(chan struct{}, workers)
+		return nil
+	}
+}
+
+// WithInstallationTimeout limits the duration of each invocation of an installer
+func WithInstallationTimeout(timeout time.Duration) PackageManagerOption {
+	return func(pm *PackageManager) error {
+		pm.installationTimeout = timeout
+		return nil
+	}
+}
+
+// WithRetryPolicy retries installer invocations failing with a Retryable error
+func WithRetryPolicy(retryPolicy RetryPolicy) PackageManagerOption {
+	return func(pm *PackageManager) error {
+		if retryPolicy.MaxAttempts < 1 {
+			return fmt.Errorf("invalid number of attempts %d", retryPolicy.MaxAttempts)
+		}
+		pm.retryPolicy = retryPolicy
+		return nil
+	}
+}
+
+// WithSecretResolver resolves requested secrets with the given resolver instead of environment variables
+func WithSecretResolver(secretResolver SecretResolver) PackageManagerOption {
+	return func(pm *PackageManager) error {
+		pm.secretResolver = secretResolver
+		return nil
+	}
+}
+
+func NewPackageManager(repository repository, options ...PackageManagerOption) (*PackageManager, error) {
+	pm := &PackageManager{repository: repository, installationsByDigest: make(map[string]*Installation), workers: make(chan struct{}, 1), retryPolicy: DefaultRetryPolicy, secretResolver: EnvSecretResolver{}, redactor: NewRedactor()}
+	for _, o := range options {
+		err := o(pm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if pm.stateStore != nil {
+		states, err := pm.stateStore.Load()
+		if err != nil {
+			return nil, fmt.Errorf("loading state failed: %v", err)
+		}
+		// credentials resolved from secrets aren't persisted
+		for _, state := range states {
+			err = state.resolveCredentials(context.Background(), pm.secretResolver)
+			if err != nil {
+				return nil, fmt.Errorf("loading state of %s failed: %w", state.PkgName, err)
+			}
+		}
+		pm.installationsByDigest, err = installationsFromStates(states)
+		if err != nil {
+			return nil, fmt.Errorf("loading state failed: %v", err)
+		}
+		for _, installation := range pm.installationsByDigest {
+			pm.redactor.registerInstallation(installation)
+		}
+	}
+	return pm, nil
+}
+
+func (s *PackageManager) save(installation *Installation) error {
+	if s.stateStore == nil {
+		return nil
+	}
+	err := s.stateStore.Save(installation.state())
+	if err != nil {
+		return fmt.Errorf("saving state of %s failed: %v", installation.PkgName, err)
+	}
+	return nil
+}
+
+func (s *PackageManager) forget(installation *Installation) error {
+	s.mutex.Lock()
+	delete(s.installationsByDigest, installation.Digest)
+	s.mutex.Unlock()
+	if s.stateStore == nil {
+		return nil
+	}
+	err := s.stateStore.Delete(installation.Digest)
+	if err != nil {
+		return fmt.Errorf("deleting state of %s failed: %v", installation.PkgName, err)
+	}
+	return nil
+}
+
+// releaseNamespace deletes the namespace of the installation's k8s target after its last installation
+// was deleted, unless the namespace has to be kept. Plans don't delete namespaces, because their installers
+// only record the operations against the targets.
+func (s *PackageManager) releaseNamespace(ctx context.Context, installation *Installation) error {
+	if s.plan != nil {
+		return nil
+	}
+	k8sTarget, ok := k8sTargetOf(installation.Target)
+	if !ok {
+		return nil
+	}
+	namespace := k8sTarget.Description().Namespace
+	if k8sTarget.Config().keepNamespace(namespace) {
+		return nil
+	}
+	digest := k8sTarget.Digest()
+	// the check of the remaining installations and the deletion are serialized with the installations
+	// started in the namespace
+	unlock := s.lock(namespaceKey(k8sTarget))
+	defer unlock()
+	s.mutex.Lock()
+	if s.installing[namespaceKey(k8sTarget)] > 0 {
+		s.mutex.Unlock()
+		return nil
+	}
+	for _, other := range s.installationsByDigest {
+		otherTarget, ok := k8sTargetOf(other.Target)
+		if ok && bytes.Equal(otherTarget.Digest(), digest) {
+			s.mutex.Unlock()
+			return nil
+		}
+	}
+	s.mutex.Unlock()
+	err := s.invoke(ctx, installation, k8sTarget.DeleteNamespace)
+	if err != nil {
+		return fmt.Errorf("deletion of namespace %s failed: %w", namespace, err)
+	}
+	return nil
+}
+
+// startInstallation counts the installation into the namespace of the target until the returned
+// function is called, so that the namespace isn't released while the installation is applied
+func (s *PackageManager) startInstallation(target Target) func() {
+	k8sTarget, ok := k8sTargetOf(target)
+	if !ok {
+		return func() {}
+	}
+	key := namespaceKey(k8sTarget)
+	unlock := s.lock(key)
+	defer unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.installing == nil {
+		s.installing = make(map[string]int)
+	}
+	s.installing[key]++
+	return func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.installing[key]--
+		if s.installing[key] == 0 {
+			delete(s.installing, key)
+		}
+	}
+}
+
+func namespaceKey(k8sTarget K8sTarget) string {
+	return "namespace/" + hex.EncodeToString(k8sTarget.Digest())
+}
+
+func (s *PackageManager) lookup(digest string) (*Installation, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	installation, ok := s.installationsByDigest[digest]
+	return installation, ok
+}
+
+// lock serializes all operations on the installation with the given digest
+func (s *PackageManager) lock(digest string) func() {
+	s.mutex.Lock()
+	if s.locks == nil {
+		s.locks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := s.locks[digest]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[digest] = lock
+	}
+	s.mutex.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+// request registers the request of entry by the installation with the given digest. Requests of all
+// concurrently applied dependencies are taken into account, so that a dependency cycle is detected
+// before waiting for the lock of an installation which (transitively) waits for the requester.
+// The returned function unregisters the request.
+func (s *PackageManager) request(requesterDigest string, entry DependencyChainEntry) (func(), error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	path := s.requestPath(entry.digest, requesterDigest, map[string]bool{})
+	if path != nil {
+		cycle := append(append([]DependencyChainEntry{s.requestOf(entry)}, path...), entry)
+		return nil, &DependencyCycle{Chain: cycle}
+	}
+	if s.requests == nil {
+		s.requests = make(map[string][]DependencyChainEntry)
+	}
+	s.requests[requesterDigest] = append(s.requests[requesterDigest], entry)
+	return func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		requests := s.requests[requesterDigest]
+		for i := range requests {
+			if requests[i] == entry {
+				requests = append(requests[:i], requests[i+1:]...)
+				break
+			}
+		}
+		if len(requests) == 0 {
+			delete(s.requests, requesterDigest)
+		} else {
+			s.requests[requesterDigest] = requests
+		}
+	}, nil
+}
+
+// requestPath returns the requests leading from the installation with digest from to the one with digest to,
+// nil if there is no such path
+func (s *PackageManager) requestPath(from string, to string, visited map[string]bool) []DependencyChainEntry {
+	if from == to {
+		return []DependencyChainEntry{}
+	}
+	if visited[from] {
+		return nil
+	}
+	visited[from] = true
+	for _, request := range s.requests[from] {
+		path := s.requestPath(request.digest, to, visited)
+		if path != nil {
+			return append([]DependencyChainEntry{request}, path...)
+		}
+	}
+	return nil
+}
+
+// requestOf returns the request currently being applied for the installation of entry. Installations which
+// are reapplied aren't requested, they are described with one of their existing requests.
+func (s *PackageManager) requestOf(entry DependencyChainEntry) DependencyChainEntry {
+	for _, requests := range s.requests {
+		for _, request := range requests {
+			if request.digest == entry.digest {
+				return request
+			}
+		}
+	}
+	request := entry
+	if installation, ok := s.installationsByDigest[entry.digest]; ok {
+		requesters := make([]string, 0, len(installation.Requests))
+		for requester := range installation.Requests {
+			requesters = append(requesters, requester)
+		}
+		sort.Strings(requesters)
+		if len(requesters) > 0 {
+			request.Requester = requesters[0]
+		}
+	}
+	return request
+}
+
+// invoke executes an installer as soon as a worker is available. Invocations failing with a Retryable
+// error are retried according to the retry policy. An interrupted invocation is reported as Interrupted.
+func (s *PackageManager) invoke(ctx context.Context, installation *Installation, cb func(ctx context.Context) error) error {
+	_, err := s.invokeAttempts(ctx, installation, cb)
+	return err
+}
+
+// invokeAttempts is invoke, additionally returning the number of attempts
+func (s *PackageManager) invokeAttempts(ctx context.Context, installation *Installation, cb func(ctx context.Context) error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := s.attempt(ctx, installation, cb)
+		if err == nil {
+			return attempt, nil
+		}
+		switch err.(type) {
+		case *DependenciesMissing, *Interrupted:
+			return attempt, err
+		}
+		if !IsRetryable(err) || attempt >= s.retryPolicy.MaxAttempts {
+			if attempt > 1 {
+				return attempt, &FailedAttempts{Attempts: attempt, Err: err}
+			}
+			return attempt, err
+		}
+		timer := time.NewTimer(s.retryPolicy.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, interrupted(installation, ctx.Err())
+		}
+	}
+}
+
+func (s *PackageManager) attempt(ctx context.Context, installation *Installation, cb func(ctx context.Context) error) error {
+	select {
+	case s.workers <- struct{}{}:
+	case <-ctx.Done():
+		return interrupted(installation, ctx.Err())
+	}
+	defer func() { <-s.workers }()
+	ctx = contextWithRedactor(ctx, s.redactor)
+	if s.installationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.installationTimeout)
+		defer cancel()
+	}
+	err := cb(ctx)
+	if err != nil && ctx.Err() != nil {
+		return interrupted(installation, err)
+	}
+	return err
+}
+
+func interrupted(installation *Installation, err error) error {
+	return &Interrupted{PkgName: installation.PkgName, Target: installation.Target.Description(), Digest: installation.Digest, Err: err}
+}
+
+// parallel calls cb for n independent items, concurrently if more than one worker is configured.
+// The first error in item order is returned.
+func (s *PackageManager) parallel(n int, cb func(i int) error) error {
+	errs := make([]error, n)
+	if cap(s.workers) <= 1 {
+		for i := 0; i < n; i++ {
+			errs[i] = cb(i)
+			if errs[i] != nil {
+				return errs[i]
+			}
+		}
+		return nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = cb(i)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *PackageManager) installer(target Target, name string, constraints IntersectedConstrains) (Installer, *semver.Version, error) {
-	installerFactory, version, err := s.repository.Get(name, constraints)
+// resolve selects the version satisfying all requests of the installation and creates its installer
+func (s *PackageManager) resolve(installation *Installation) (Installer, *semver.Version, error) {
+	installerFactory, version, err := resolveVersion(s.repository, installation)
 	if err != nil {
 		return nil, nil, err
 	}
-	installer, err := installerFactory(target, version)
+	installer, err := s.installer(installation, installerFactory, version)
 	return installer, version, err
 }
 
-func installationDigest(target Target, pkgName string) string {
+func (s *PackageManager) installer(installation *Installation, installerFactory InstallerFactory, version *semver.Version) (Installer, error) {
+	target := installation.Target
+	if s.plan != nil {
+		var err error
+		target, err = newRecordingTarget(target, s.plan.recorder(installation.Digest))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return installerFactory(target, version)
+}
+
+// installedInstaller creates the installer of the version which is currently installed
+func (s *PackageManager) installedInstaller(installation *Installation) (Installer, error) {
+	installerFactory, err := s.repository.getVersion(installation.PkgName, installation.Version)
+	if err != nil {
+		return nil, err
+	}
+	return s.installer(installation, installerFactory, installation.Version)
+}
+
+// InstallationDigest identifies the installation of a package into a target
+func InstallationDigest(target Target, pkgName string) string {
 	hash := md5.New()
 	hash.Write(target.Digest())
 	hash.Write([]byte(pkgName))
@@ -36,16 +435,94 @@ func installationDigest(target Target, pkgName string) string {
 }
 
 func (s *PackageManager) Apply(target Target, pkgName string, constraint *semver.Constraints, parameter Parameter) (*Installation, error) {
-	return s.apply(target, pkgName, constraint, parameter, "package-manager")
+	return s.ApplyContext(context.Background(), target, pkgName, constraint, parameter)
+}
+
+// ApplyContext applies the given package. If ctx is cancelled, the resolution of dependencies stops and
+// an Interrupted error reports the installation which was interrupted. Changes are rolled back.
+func (s *PackageManager) ApplyContext(ctx context.Context, target Target, pkgName string, constraint *semver.Constraints, parameter Parameter) (*Installation, error) {
+	tx := &transaction{}
+	installation, err := s.apply(ctx, target, pkgName, constraint, parameter, packageManagerRequester, "", tx)
+	if err == nil {
+		err = s.propagate(ctx, tx)
+	}
+	if err != nil {
+		return nil, s.redactor.RedactError(s.rollback(tx, err))
+	}
+	return installation, nil
+}
+
+// Plan resolves the complete dependency graph of the given package like Apply, but
+// against recording targets. Neither the targets nor the state of the package manager are modified.
+func (s *PackageManager) Plan(target Target, pkgName string, constraint *semver.Constraints, parameter Parameter) (*Plan, error) {
+	return s.PlanContext(context.Background(), target, pkgName, constraint, parameter)
 }
 
+func (s *PackageManager) PlanContext(ctx context.Context, target Target, pkgName string, constraint *semver.Constraints, parameter Parameter) (*Plan, error) {
+	s.mutex.Lock()
+	states := make([]*InstallationState, 0, len(s.installationsByDigest))
+	for _, installation := range s.installationsByDigest {
+		states = append(states, installation.state())
+	}
+	s.mutex.Unlock()
+	installations, err := installationsFromStates(states)
+	if err != nil {
+		return nil, err
+	}
+	planner := &PackageManager{repository: s.repository, installationsByDigest: installations, plan: &Plan{redactor: s.redactor}, workers: make(chan struct{}, 1), secretResolver: s.secretResolver, redactor: s.redactor}
+	_, err = planner.ApplyContext(ctx, target, pkgName, constraint, parameter)
+	if err != nil {
+		return nil, s.redactor.RedactError(err)
+	}
+	return planner.plan, nil
+}
+
+// States returns the state of all installations sorted by digest. Sensitive values are redacted.
+func (s *PackageManager) States() ([]*InstallationState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	states := make([]*InstallationState, 0, len(s.installationsByDigest))
+	for _, installation := range s.installationsByDigest {
+		state, err := s.redactor.RedactState(installation.state())
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Digest < states[j].Digest
+	})
+	return states, nil
+}
+
+// packageManagerRequester requests the installations applied by the users of the package manager
+const packageManagerRequester = "package-manager"
+
 func requesterName(pkgName string, digest string) string {
 	return pkgName + "/" + digest
 }
 
-func (s *PackageManager) apply(target Target, pkgName string, constraints *semver.Constraints, parameter Parameter, requester string) (*Installation, error) {
-	digest := installationDigest(target, pkgName)
-	installation, ok := s.installationsByDigest[digest]
+// apply installs the given package. requesterDigest is the digest of the requesting installation, empty if
+// requested by the users of the package manager. All created and modified installations are recorded in tx.
+func (s *PackageManager) apply(ctx context.Context, target Target, pkgName string, constraints *semver.Constraints, parameter Parameter, requester string, requesterDigest string, tx *transaction) (*Installation, error) {
+	digest := InstallationDigest(target, pkgName)
+	release, err := s.request(requesterDigest, DependencyChainEntry{PkgName: pkgName, Target: target.Description(), Requester: requester, digest: digest})
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	unlock := s.lock(digest)
+	defer unlock()
+	installation, ok := s.lookup(digest)
+	if !ok {
+		done := s.startInstallation(target)
+		defer done()
+	}
+	s.notify(&ResolutionStarted{
+		EventInstallation: EventInstallation{Digest: digest, PkgName: pkgName, Target: target.Description()},
+		Requester:         requester,
+		Constraints:       constraints.String(),
+	})
 	installationRequest := InstallationRequest{
 		PkgName:     pkgName,
 		Constraints: constraints,
@@ -53,101 +530,288 @@ func (s *PackageManager) apply(target Target, pkgName string, constraints *semve
 		Parameter:   parameter,
 	}
 
+	action := PlanActionInstall
+	var previousRequest *InstallationRequest
 	if ok {
+		action = PlanActionUpdate
 		request, ok := installation.Requests[requester]
 		if ok {
-			if bytes.Compare(request.Parameter, installationRequest.Parameter) == 0 && request.Constraints == installationRequest.Constraints {
+			if bytes.Compare(request.Parameter, installationRequest.Parameter) == 0 && request.Constraints.String() == installationRequest.Constraints.String() {
+				s.plan.add(installation, requester, PlanActionUnchanged)
+				s.notify(&Skipped{EventInstallation: eventInstallation(installation), Reason: fmt.Sprintf("request of %s unchanged", requester)})
 				return installation, nil
 			}
+			previousRequest = &request
 		}
+		tx.modify(installation)
 		installation.Requests[requester] = installationRequest
 	} else {
 		installation = &Installation{PkgName: pkgName, Target: target, Digest: digest, Requests: map[string]InstallationRequest{requester: installationRequest}, Responses: map[string]Response{}}
 	}
-	installer, version, err := s.installer(target, pkgName, installation.IntersectedConstraints())
+	// all constraints of the shared installation are taken into account, the installation is
+	// reapplied with the newly selected version
+	installer, version, err := s.resolve(installation)
+	if err != nil {
+		if previousRequest != nil {
+			installation.Requests[requester] = *previousRequest
+		} else {
+			delete(installation.Requests, requester)
+		}
+		s.notifyFailed(installation, err, 0)
+		return nil, err
+	}
+	s.notifyVersionSelected(installation, version)
 	installation.Version = version
+	err = s.run(ctx, installation, installer, tx)
 	if err != nil {
 		return nil, err
 	}
-	subRequester := requesterName(pkgName, digest)
+	s.mutex.Lock()
+	s.installationsByDigest[digest] = installation
+	s.mutex.Unlock()
+	if action == PlanActionInstall {
+		tx.create(installation)
+	}
+	s.plan.add(installation, requester, action)
+	err = s.save(installation)
+	if err != nil {
+		return nil, err
+	}
+	return installation, nil
+}
+
+// run executes the installer until all its dependencies are satisfied
+func (s *PackageManager) run(ctx context.Context, installation *Installation, installer Installer, tx *transaction) error {
+	subRequester := requesterName(installation.PkgName, installation.Digest)
+	stage := nextStage(installation.Children)
 	for {
-		joinedParamater := []Parameter{}
-		for _, r := range installation.Requests {
-			if r.Parameter != nil {
-				joinedParamater = append(joinedParamater, r.Parameter)
-			}
+		if ctx.Err() != nil {
+			return interrupted(installation, ctx.Err())
+		}
+		s.redactor.registerInstallation(installation)
+		var helper *InstallationHelper
+		attempts, err := s.invokeAttempts(ctx, installation, func(ctx context.Context) (err error) {
+			helper = NewDependencyChecker(installation.parameters(), installation.Responses)
+			installation.Response, err = installer.Apply(ctx, installation.Digest, nil, helper)
+			return
+		})
+		// the installer isn't invoked if the context is done while waiting for a worker
+		if helper != nil {
+			installation.Parameter = helper.mergedParameter
 		}
-		installation.Response, err = installer.Apply(digest, nil, NewDependencyChecker(joinedParamater, installation.Responses))
 		if err != nil {
 			dependenciesMissing, ok := err.(*DependenciesMissing)
 			if ok {
-				for k, v := range dependenciesMissing.DependencyRequests {
+				names := make([]string, 0, len(dependenciesMissing.DependencyRequests))
+				for k := range dependenciesMissing.DependencyRequests {
+					names = append(names, k)
+				}
+				sort.Strings(names)
+				var installationRequests []string
+				for _, k := range names {
+					v := dependenciesMissing.DependencyRequests[k]
 					ir := v.Installation
 					if ir != nil {
 						if ir.Target == nil {
-							ir.Target = target
+							ir.Target = installation.Target
 						}
-						depInstallation, err := s.apply(ir.Target, ir.PkgName, ir.Constraints, ir.Parameter, subRequester)
+						installationRequests = append(installationRequests, k)
+						s.notify(&DependencyRequested{EventInstallation: eventInstallation(installation), Name: k, Dependency: ir.PkgName, DependencyTarget: ir.Target.Description()})
+					}
+					if v.Secret != nil {
+						err := s.resolveSecret(ctx, installation, k, v.Secret)
 						if err != nil {
-							return nil, err
+							return err
 						}
-						installation.Children = append(installation.Children, depInstallation)
-						installation.Responses[k] = depInstallation.Response
 					}
-					sc := v.Secret
-					if sc != nil {
-						env, ok := os.LookupEnv(sc.Name)
-						if !ok {
-							return nil, fmt.Errorf("missing environment variable %s", sc.Name)
-						}
-						installation.Responses[k] = []byte(env)
+				}
+				// dependencies requested together don't depend on each other
+				children := make([]*Child, len(installationRequests))
+				err = s.parallel(len(installationRequests), func(i int) error {
+					k := installationRequests[i]
+					ir := dependenciesMissing.DependencyRequests[k].Installation
+					depInstallation, err := s.apply(ctx, ir.Target, ir.PkgName, ir.Constraints, ir.Parameter, subRequester, installation.Digest, tx)
+					if err != nil {
+						return err
 					}
+					children[i] = &Child{Name: k, Stage: stage, Installation: depInstallation}
+					return nil
+				})
+				for _, child := range children {
+					if child != nil {
+						installation.Children = append(installation.Children, child)
+						installation.Responses[child.Name] = child.Installation.Response
+					}
+				}
+				if err != nil {
+					return err
 				}
+				stage++
+			} else if _, ok := err.(*Interrupted); ok {
+				s.notifyFailed(installation, err, attempts)
+				return err
 			} else {
-				return nil, fmt.Errorf("apply of %s:%s on target %v failed: %v", pkgName, constraints.String(), target, err)
+				s.notifyFailed(installation, err, attempts)
+				return fmt.Errorf("apply of %s:%s on target %v failed: %w", installation.PkgName, installation.Version, installation.Target.Description(), err)
 			}
 		} else {
+			s.notify(&InstallerApplied{EventInstallation: eventInstallation(installation), Attempts: attempts})
 			break
 		}
 	}
-	if s.installationsByDigest == nil {
-		s.installationsByDigest = make(map[string]*Installation)
+	return nil
+}
+
+// resolveSecret passes the requested secret as response to the installation. Secrets aren't persisted.
+func (s *PackageManager) resolveSecret(ctx context.Context, installation *Installation, name string, request *SecretRequest) error {
+	secret, err := s.secretResolver.Resolve(ctx, request.Name)
+	if err != nil {
+		return fmt.Errorf("resolution of secret %s for %s:%s failed: %w", request.Name, installation.PkgName, installation.Version, err)
+	}
+	s.redactor.RegisterSecret(secret)
+	installation.Responses[name] = secret
+	if installation.secrets == nil {
+		installation.secrets = make(map[string]struct{})
 	}
-	s.installationsByDigest[digest] = installation
+	installation.secrets[name] = struct{}{}
+	return nil
+}
 
-	return installation, nil
+func nextStage(children []*Child) int {
+	stage := 0
+	for _, child := range children {
+		if child.Stage >= stage {
+			stage = child.Stage + 1
+		}
+	}
+	return stage
 }
 
 func (s *PackageManager) Delete(target Target, pkgName string) error {
-	digest := installationDigest(target, pkgName)
-	installation, ok := s.installationsByDigest[digest]
+	return s.DeleteContext(context.Background(), target, pkgName)
+}
+
+func (s *PackageManager) DeleteContext(ctx context.Context, target Target, pkgName string) error {
+	digest := InstallationDigest(target, pkgName)
+	installation, ok := s.lookup(digest)
 	if !ok {
 		return fmt.Errorf("Installation %s not found in target %v", pkgName, target)
 	}
-	return s.delete(installation, "package-manager")
+	err := s.delete(ctx, installation, packageManagerRequester)
+	if err == nil {
+		err = s.propagate(ctx, nil)
+	}
+	return s.redactor.RedactError(err)
 }
 
-func (s *PackageManager) delete(installation *Installation, requester string) error {
+func (s *PackageManager) delete(ctx context.Context, installation *Installation, requester string) error {
+	unlock := s.lock(installation.Digest)
+	defer unlock()
 	delete(installation.Requests, requester)
 	if len(installation.Requests) != 0 {
-		return nil
+		err := s.update(ctx, installation)
+		if err != nil {
+			return err
+		}
+		return s.save(installation)
 	}
-	installer, _, err := s.installer(installation.Target, installation.PkgName, installation.IntersectedConstraints())
+	installer, err := s.installedInstaller(installation)
 	if err != nil {
 		return err
 	}
-	err = installer.Delete(installation.Digest)
+	if ctx.Err() != nil {
+		return interrupted(installation, ctx.Err())
+	}
+	err = s.invokeDelete(ctx, installation, installer)
 	if err != nil {
 		return err
 	}
 	subRequester := requesterName(installation.PkgName, installation.Digest)
-	dependencies := installation.Children
-	for i := len(dependencies) - 1; i >= 0; i-- {
-		err = s.delete(dependencies[i], subRequester)
+	// delete the stages in reverse order, children within a stage don't depend on each other
+	for stage := nextStage(installation.Children) - 1; stage >= 0; stage-- {
+		var children []*Child
+		for i := len(installation.Children) - 1; i >= 0; i-- {
+			if installation.Children[i].Stage == stage {
+				children = append(children, installation.Children[i])
+			}
+		}
+		err = s.parallel(len(children), func(i int) error {
+			return s.delete(ctx, children[i].Installation, subRequester)
+		})
 		if err != nil {
 			return err
 		}
 	}
-	delete(s.installationsByDigest, installation.Digest)
+	err = s.forget(installation)
+	if err != nil {
+		return err
+	}
+	return s.releaseNamespace(ctx, installation)
+}
+
+// invokeDelete deletes the installation with its installer
+func (s *PackageManager) invokeDelete(ctx context.Context, installation *Installation, installer Installer) error {
+	attempts, err := s.invokeAttempts(ctx, installation, func(ctx context.Context) error {
+		return installer.Delete(ctx, installation.Digest)
+	})
+	if err != nil {
+		s.notifyFailed(installation, err, attempts)
+		return err
+	}
+	s.notify(&InstallerDeleted{EventInstallation: eventInstallation(installation), Attempts: attempts})
 	return nil
 }
+
+// update reapplies an installation if its remaining requests result in a different version or merged parameter
+func (s *PackageManager) update(ctx context.Context, installation *Installation) error {
+	installerFactory, version, err := resolveVersion(s.repository, installation)
+	if err != nil {
+		return err
+	}
+	changed := !version.Equal(installation.Version)
+	if !changed {
+		changed, err = s.parameterChanged(ctx, installation, installerFactory)
+		if err != nil {
+			return err
+		}
+	}
+	if !changed {
+		s.notify(&Skipped{EventInstallation: eventInstallation(installation), Reason: "remaining requests unchanged"})
+		return nil
+	}
+	installer, err := s.installer(installation, installerFactory, version)
+	if err != nil {
+		return err
+	}
+	s.notifyVersionSelected(installation, version)
+	installation.Version = version
+	return s.run(ctx, installation, installer, nil)
+}
+
+// parameterChanged merges the parameters of the current requests by executing the installer against
+// a recording target and compares them with the parameter of the last application
+func (s *PackageManager) parameterChanged(ctx context.Context, installation *Installation, installerFactory InstallerFactory) (bool, error) {
+	target, err := newRecordingTarget(installation.Target, func(string) {})
+	if err != nil {
+		return false, err
+	}
+	installer, err := installerFactory(target, installation.Version)
+	if err != nil {
+		return false, err
+	}
+	helper := NewDependencyChecker(installation.parameters(), installation.Responses)
+	_, err = installer.Apply(ctx, installation.Digest, nil, helper)
+	if err != nil {
+		dependenciesMissing, ok := err.(*DependenciesMissing)
+		if !ok {
+			return false, fmt.Errorf("merging parameters of %s on target %v failed: %v", installation.PkgName, installation.Target.Description(), err)
+		}
+		// secrets aren't persisted and therefore missing after a restart
+		for _, request := range dependenciesMissing.DependencyRequests {
+			if request.Secret == nil {
+				return true, nil
+			}
+		}
+	}
+	return !JsonEqual(helper.mergedParameter, installation.Parameter), nil
+}
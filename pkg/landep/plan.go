@@ -0,0 +1,83 @@
+package landep
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type PlanAction string
+
+const (
+	PlanActionInstall   PlanAction = "install"
+	PlanActionUpdate    PlanAction = "update"
+	PlanActionUnchanged PlanAction = "unchanged"
+)
+
+// PlanStep describes the application of one installation. Operations contains the
+// calls the installer issued against its target.
+type PlanStep struct {
+	Action     PlanAction         `json:"action"`
+	Digest     string             `json:"digest"`
+	PkgName    string             `json:"pkgName"`
+	Version    string             `json:"version"`
+	Target     *TargetDescription `json:"target"`
+	Requester  string             `json:"requester"`
+	Parameter  Parameter          `json:"parameter,omitempty"`
+	Operations []string           `json:"operations,omitempty"`
+}
+
+// Plan lists the steps Apply would execute in the order of their execution
+type Plan struct {
+	Steps      []*PlanStep `json:"steps"`
+	operations map[string][]string
+	redactor   *Redactor
+	mutex      sync.Mutex
+}
+
+func (s *Plan) recorder(digest string) func(operation string) {
+	return func(operation string) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.operations == nil {
+			s.operations = make(map[string][]string)
+		}
+		s.operations[digest] = append(s.operations[digest], s.redactor.Redact(operation))
+	}
+}
+
+func (s *Plan) add(installation *Installation, requester string, action PlanAction) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	step := &PlanStep{
+		Action:     action,
+		Digest:     installation.Digest,
+		PkgName:    installation.PkgName,
+		Target:     installation.Target.Description(),
+		Requester:  requester,
+		Parameter:  s.redactor.RedactJSON(installation.Parameter),
+		Operations: s.operations[installation.Digest],
+	}
+	if installation.Version != nil {
+		step.Version = installation.Version.String()
+	}
+	delete(s.operations, installation.Digest)
+	s.Steps = append(s.Steps, step)
+}
+
+func (s *Plan) String() string {
+	var sb strings.Builder
+	for i, step := range s.Steps {
+		sb.WriteString(fmt.Sprintf("%d. %s %s %s into %s requested by %s\n", i+1, step.Action, step.PkgName, step.Version, step.Target, step.Requester))
+		if step.Parameter != nil {
+			sb.WriteString(fmt.Sprintf("   parameter: %s\n", string(step.Parameter)))
+		}
+		for _, operation := range step.Operations {
+			sb.WriteString(fmt.Sprintf("   %s\n", operation))
+		}
+	}
+	return sb.String()
+}
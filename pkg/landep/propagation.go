@@ -0,0 +1,90 @@
+package landep
+
+import (
+	"context"
+	"sort"
+)
+
+// staleChildren returns the children whose current response differs from the response
+// the installation consumed during its last application
+func (s *Installation) staleChildren() []*Child {
+	var stale []*Child
+	for _, child := range s.Children {
+		if !JsonEqual(s.Responses[child.Name], child.Installation.Response) {
+			stale = append(stale, child)
+		}
+	}
+	return stale
+}
+
+// topologicalOrder returns all installations, children before their parents
+func (s *PackageManager) topologicalOrder() []*Installation {
+	s.mutex.Lock()
+	digests := make([]string, 0, len(s.installationsByDigest))
+	for digest := range s.installationsByDigest {
+		digests = append(digests, digest)
+	}
+	installations := make(map[string]*Installation, len(s.installationsByDigest))
+	for digest, installation := range s.installationsByDigest {
+		installations[digest] = installation
+	}
+	s.mutex.Unlock()
+	sort.Strings(digests)
+
+	var result []*Installation
+	visited := make(map[string]bool, len(digests))
+	var visit func(installation *Installation)
+	visit = func(installation *Installation) {
+		if visited[installation.Digest] {
+			return
+		}
+		visited[installation.Digest] = true
+		for _, child := range installation.Children {
+			visit(child.Installation)
+		}
+		result = append(result, installation)
+	}
+	for _, digest := range digests {
+		visit(installations[digest])
+	}
+	return result
+}
+
+// propagate reapplies all installations which consumed an outdated response of one of their children.
+// Installations are processed children first, so that changed responses of reapplied installations
+// are propagated to their dependents as well.
+func (s *PackageManager) propagate(ctx context.Context, tx *transaction) error {
+	for _, installation := range s.topologicalOrder() {
+		err := s.refresh(ctx, installation, tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PackageManager) refresh(ctx context.Context, installation *Installation, tx *transaction) error {
+	unlock := s.lock(installation.Digest)
+	defer unlock()
+	if _, ok := s.lookup(installation.Digest); !ok {
+		return nil
+	}
+	stale := installation.staleChildren()
+	if len(stale) == 0 {
+		return nil
+	}
+	tx.modify(installation)
+	for _, child := range stale {
+		installation.Responses[child.Name] = child.Installation.Response
+	}
+	installer, err := s.installedInstaller(installation)
+	if err != nil {
+		return err
+	}
+	err = s.run(ctx, installation, installer, tx)
+	if err != nil {
+		return err
+	}
+	s.plan.add(installation, requesterName(stale[0].Installation.PkgName, stale[0].Installation.Digest), PlanActionUpdate)
+	return s.save(installation)
+}
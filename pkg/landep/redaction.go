@@ -0,0 +1,287 @@
+package landep
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RedactedValue replaces sensitive values in log lines, error messages, plans and state dumps
+const RedactedValue = "***"
+
+// minSensitiveValueLength avoids masking unrelated text with very short values
+const minSensitiveValueLength = 4
+
+// sensitiveKeys are (normalized) JSON keys whose values are sensitive
+var sensitiveKeys = []string{"password", "secret", "token", "apikey", "privatekey", "passphrase"}
+
+// Redactor masks sensitive values it has been told about
+type Redactor struct {
+	mutex    sync.RWMutex
+	values   map[string]struct{}
+	replacer *strings.Replacer
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{values: make(map[string]struct{})}
+}
+
+// WithRedactor masks sensitive values with the given redactor, e.g. to share it between package managers.
+// Otherwise, each package manager has a redactor of its own.
+func WithRedactor(redactor *Redactor) PackageManagerOption {
+	return func(pm *PackageManager) error {
+		pm.redactor = redactor
+		return nil
+	}
+}
+
+type redactorKey struct{}
+
+// contextWithRedactor passes the redactor of the package manager to the targets. Targets register the
+// credentials they obtain, the fake targets mask their log lines.
+func contextWithRedactor(ctx context.Context, redactor *Redactor) context.Context {
+	return context.WithValue(ctx, redactorKey{}, redactor)
+}
+
+// redactorFrom returns the redactor passed with the context, nil if there is none
+func redactorFrom(ctx context.Context) *Redactor {
+	redactor, _ := ctx.Value(redactorKey{}).(*Redactor)
+	return redactor
+}
+
+// Register marks values as sensitive
+func (s *Redactor) Register(values ...string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, value := range values {
+		if len(value) < minSensitiveValueLength {
+			continue
+		}
+		s.add(value)
+		// values embedded into JSON documents are escaped
+		if escaped, err := json.Marshal(value); err == nil {
+			s.add(string(escaped[1 : len(escaped)-1]))
+		}
+	}
+}
+
+func (s *Redactor) add(value string) {
+	if _, ok := s.values[value]; ok {
+		return
+	}
+	s.values[value] = struct{}{}
+	s.replacer = nil
+}
+
+// RegisterSecret marks all string values of a resolved secret as sensitive
+func (s *Redactor) RegisterSecret(secret Secret) {
+	var value interface{}
+	if json.Unmarshal(secret, &value) != nil {
+		s.Register(string(secret))
+		return
+	}
+	s.Register(stringValues(value, true)...)
+}
+
+// RegisterSensitiveFields marks the string values of all fields with sensitive names
+// (e.g. password or token) contained in the JSON document as sensitive
+func (s *Redactor) RegisterSensitiveFields(data json.RawMessage) {
+	if len(data) == 0 {
+		return
+	}
+	var value interface{}
+	if json.Unmarshal(data, &value) != nil {
+		return
+	}
+	s.Register(stringValues(value, false)...)
+}
+
+func (s *Redactor) registerInstallation(installation *Installation) {
+	if installation.Target != nil {
+		description := installation.Target.Description()
+		if target, err := json.Marshal(description); err == nil {
+			s.RegisterSensitiveFields(target)
+		}
+		// credentials resolved from secrets aren't marshalled
+		if config := description.CloudFoundryConfig; config != nil {
+			s.Register(config.CloudFoundryCredentials.Basic.Password, config.UAACredentials.Basic.Password)
+		}
+	}
+	s.RegisterSensitiveFields(installation.Parameter)
+	for _, parameter := range installation.parameters() {
+		s.RegisterSensitiveFields(parameter)
+	}
+	s.RegisterSensitiveFields(installation.Response)
+	for _, response := range installation.Responses {
+		s.RegisterSensitiveFields(response)
+	}
+}
+
+// Redact replaces all sensitive values contained in text
+func (s *Redactor) Redact(text string) string {
+	if s == nil {
+		return text
+	}
+	s.mutex.RLock()
+	replacer := s.replacer
+	s.mutex.RUnlock()
+	if replacer == nil {
+		s.mutex.Lock()
+		if s.replacer == nil {
+			values := make([]string, 0, len(s.values))
+			for value := range s.values {
+				values = append(values, value)
+			}
+			// replace longer values first, if one contains the other
+			sort.Slice(values, func(i, j int) bool {
+				return len(values[i]) > len(values[j])
+			})
+			oldnew := make([]string, 0, 2*len(values))
+			for _, value := range values {
+				oldnew = append(oldnew, value, RedactedValue)
+			}
+			s.replacer = strings.NewReplacer(oldnew...)
+		}
+		replacer = s.replacer
+		s.mutex.Unlock()
+	}
+	return replacer.Replace(text)
+}
+
+// RedactJSON replaces all sensitive values and the values of all fields with sensitive names
+// contained in a JSON document. Keys are kept.
+func (s *Redactor) RedactJSON(data json.RawMessage) json.RawMessage {
+	if len(data) == 0 {
+		return data
+	}
+	var value interface{}
+	if json.Unmarshal(data, &value) != nil {
+		return json.RawMessage(s.Redact(string(data)))
+	}
+	result, err := json.Marshal(s.redactValue(value, false))
+	if err != nil {
+		return json.RawMessage(s.Redact(string(data)))
+	}
+	return result
+}
+
+func (s *Redactor) redactValue(value interface{}, sensitive bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		if sensitive && v != "" {
+			return RedactedValue
+		}
+		return s.Redact(v)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			result[key] = s.redactValue(value, sensitive || isSensitiveKey(key))
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, value := range v {
+			result[i] = s.redactValue(value, sensitive)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// RedactError returns err itself if its message doesn't contain sensitive values. Otherwise,
+// it returns a RedactedError wrapping err.
+func (s *Redactor) RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+	redacted := s.Redact(message)
+	if redacted == message {
+		return err
+	}
+	return &RedactedError{message: redacted, Err: err}
+}
+
+// RedactState returns a copy of the state with all sensitive values of the parameters, responses and
+// targets masked. Digest, package, version and children are kept, so the state still identifies the installation.
+func (s *Redactor) RedactState(state *InstallationState) (*InstallationState, error) {
+	result := *state
+	var err error
+	result.Target, err = s.redactTarget(state.Target)
+	if err != nil {
+		return nil, err
+	}
+	result.Requests = make(map[string]InstallationRequestState, len(state.Requests))
+	for requester, request := range state.Requests {
+		request.Target, err = s.redactTarget(request.Target)
+		if err != nil {
+			return nil, err
+		}
+		request.Parameter = s.RedactJSON(request.Parameter)
+		result.Requests[requester] = request
+	}
+	result.Parameter = s.RedactJSON(state.Parameter)
+	result.Response = s.RedactJSON(state.Response)
+	if state.Responses != nil {
+		result.Responses = make(map[string]Response, len(state.Responses))
+		for name, response := range state.Responses {
+			result.Responses[name] = s.RedactJSON(response)
+		}
+	}
+	return &result, nil
+}
+
+func (s *Redactor) redactTarget(target *TargetDescription) (*TargetDescription, error) {
+	if target == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(target)
+	if err != nil {
+		return nil, fmt.Errorf("redaction of target %s failed: %v", target, err)
+	}
+	var result TargetDescription
+	err = json.Unmarshal(s.RedactJSON(data), &result)
+	if err != nil {
+		return nil, fmt.Errorf("redaction of target %s failed: %v", target, err)
+	}
+	return &result, nil
+}
+
+func stringValues(value interface{}, sensitive bool) []string {
+	var result []string
+	switch v := value.(type) {
+	case string:
+		if sensitive {
+			result = append(result, v)
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			result = append(result, stringValues(value, sensitive || isSensitiveKey(key))...)
+		}
+	case []interface{}:
+		for _, value := range v {
+			result = append(result, stringValues(value, sensitive)...)
+		}
+	}
+	return result
+}
+
+func isSensitiveKey(key string) bool {
+	normalized := strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+	if normalized == "auth" {
+		return true
+	}
+	for _, sensitiveKey := range sensitiveKeys {
+		if strings.Contains(normalized, sensitiveKey) {
+			return true
+		}
+	}
+	return false
+}
@@ -26,22 +26,13 @@ func (s *repository) Register(name string, version *semver.Version, installer In
 	(*s)[name] = installers
 }
 
-func (s *repository) Get(name string, contraints IntersectedConstrains) (InstallerFactory, *semver.Version, error) {
-	installers, ok := (*s)[name]
-	if !ok {
-		return nil, nil, fmt.Errorf("Installer for name %s not found", name)
-	}
-	var installersMatchingVersion []versionedInstaller
-	for _, i := range installers {
-		if contraints.Check(i.version) {
-			installersMatchingVersion = append(installersMatchingVersion, i)
+var Repository = repository{}
+
+func (s *repository) getVersion(name string, version *semver.Version) (InstallerFactory, error) {
+	for _, i := range (*s)[name] {
+		if i.version.Equal(version) {
+			return i.installer, nil
 		}
 	}
-	if len(installersMatchingVersion) == 0 {
-		return nil, nil, fmt.Errorf("Installer for name %s constraints %s not found", name, contraints.String())
-	}
-	// first one contains highest version
-	return installersMatchingVersion[0].installer, installersMatchingVersion[0].version, nil
+	return nil, fmt.Errorf("Installer for name %s version %v not found", name, version)
 }
-
-var Repository = repository{}
@@ -0,0 +1,101 @@
+package landep
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// RequesterConstraints are the constraints a requester put on an installation
+type RequesterConstraints struct {
+	Requester   string   `json:"requester"`
+	Constraints string   `json:"constraints"`
+	Allowed     []string `json:"allowed"`
+	Conflicting bool     `json:"conflicting"`
+}
+
+// VersionConflict is returned if no registered version of a package satisfies the constraints of all requesters
+// of a shared installation. Requesters are marked as conflicting if no version satisfies them at all,
+// or if the constraints of the remaining requesters could be satisfied without them.
+type VersionConflict struct {
+	PkgName    string                 `json:"pkgName"`
+	Target     *TargetDescription     `json:"target"`
+	Versions   []string               `json:"versions"`
+	Requesters []RequesterConstraints `json:"requesters"`
+}
+
+func (s *VersionConflict) Error() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("no version of %s on %s satisfies all requesters (available: %s)", s.PkgName, s.Target, strings.Join(s.Versions, ", ")))
+	for _, r := range s.Requesters {
+		if !r.Conflicting {
+			continue
+		}
+		allowed := "none"
+		if len(r.Allowed) != 0 {
+			allowed = strings.Join(r.Allowed, ", ")
+		}
+		sb.WriteString(fmt.Sprintf("; %s requires %s (allows %s)", r.Requester, r.Constraints, allowed))
+	}
+	return sb.String()
+}
+
+var _ error = (*VersionConflict)(nil)
+
+// resolveVersion selects the highest registered version of the installation's package which satisfies
+// the constraints of all requests
+func resolveVersion(repository repository, installation *Installation) (InstallerFactory, *semver.Version, error) {
+	installers, ok := repository[installation.PkgName]
+	if !ok {
+		return nil, nil, fmt.Errorf("Installer for name %s not found", installation.PkgName)
+	}
+	requesters := make([]string, 0, len(installation.Requests))
+	for requester := range installation.Requests {
+		requesters = append(requesters, requester)
+	}
+	sort.Strings(requesters)
+	// first one contains highest version
+	for _, i := range installers {
+		if satisfies(installation, requesters, "", i.version) {
+			return i.installer, i.version, nil
+		}
+	}
+	conflict := &VersionConflict{PkgName: installation.PkgName, Target: installation.Target.Description()}
+	for _, i := range installers {
+		conflict.Versions = append(conflict.Versions, i.version.String())
+	}
+	anyConflicting := false
+	for _, requester := range requesters {
+		r := RequesterConstraints{Requester: requester, Constraints: installation.Requests[requester].Constraints.String()}
+		solvableWithout := false
+		for _, i := range installers {
+			if installation.Requests[requester].Constraints.Check(i.version) {
+				r.Allowed = append(r.Allowed, i.version.String())
+			}
+			if satisfies(installation, requesters, requester, i.version) {
+				solvableWithout = true
+			}
+		}
+		r.Conflicting = len(r.Allowed) == 0 || solvableWithout
+		anyConflicting = anyConflicting || r.Conflicting
+		conflict.Requesters = append(conflict.Requesters, r)
+	}
+	if !anyConflicting {
+		// only a combination of requesters conflicts
+		for i := range conflict.Requesters {
+			conflict.Requesters[i].Conflicting = true
+		}
+	}
+	return nil, nil, conflict
+}
+
+func satisfies(installation *Installation, requesters []string, ignoredRequester string, version *semver.Version) bool {
+	for _, requester := range requesters {
+		if requester != ignoredRequester && !installation.Requests[requester].Constraints.Check(version) {
+			return false
+		}
+	}
+	return true
+}
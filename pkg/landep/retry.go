@@ -0,0 +1,33 @@
+package landep
+
+import "time"
+
+// RetryPolicy defines how often and how fast installer invocations failing with a Retryable error are retried
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of invocations per installation, including the first one
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt
+	InitialBackoff time.Duration
+	// MaxBackoff limits the delay between two attempts. Zero means no limit.
+	MaxBackoff time.Duration
+	// Multiplier increases the delay after each attempt. Values below 1 keep the delay constant.
+	Multiplier float64
+}
+
+// DefaultRetryPolicy doesn't retry at all
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+// backoff returns the delay after the given (failed) attempt
+func (s RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := float64(s.InitialBackoff)
+	for i := 1; i < attempt && s.Multiplier > 1; i++ {
+		backoff *= s.Multiplier
+		if s.MaxBackoff > 0 && backoff >= float64(s.MaxBackoff) {
+			break
+		}
+	}
+	if s.MaxBackoff > 0 && backoff > float64(s.MaxBackoff) {
+		return s.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
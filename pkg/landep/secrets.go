@@ -0,0 +1,116 @@
+package landep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SecretResolver resolves the secrets requested with InstallationHelper.SecretRequest.
+// Secrets are JSON documents. Unknown secrets are reported as SecretNotFound.
+type SecretResolver interface {
+	Resolve(ctx context.Context, name string) (Secret, error)
+}
+
+// SecretResolverFunc adapts a function to a SecretResolver
+type SecretResolverFunc func(ctx context.Context, name string) (Secret, error)
+
+func (s SecretResolverFunc) Resolve(ctx context.Context, name string) (Secret, error) {
+	return s(ctx, name)
+}
+
+var _ SecretResolver = SecretResolverFunc(nil)
+
+// EnvSecretResolver reads secrets from environment variables named like the secret. The values are
+// passed as they are.
+type EnvSecretResolver struct{}
+
+var _ SecretResolver = EnvSecretResolver{}
+
+func (s EnvSecretResolver) Resolve(ctx context.Context, name string) (Secret, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, &SecretNotFound{Name: name, Source: "environment"}
+	}
+	return Secret(value), nil
+}
+
+// DirectorySecretResolver reads each secret from a file named like the secret,
+// e.g. a mounted Kubernetes secret. The contents are passed as they are.
+type DirectorySecretResolver struct {
+	dir string
+}
+
+var _ SecretResolver = (*DirectorySecretResolver)(nil)
+
+func NewDirectorySecretResolver(dir string) *DirectorySecretResolver {
+	return &DirectorySecretResolver{dir: dir}
+}
+
+func (s *DirectorySecretResolver) Resolve(ctx context.Context, name string) (Secret, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil, &SecretNotFound{Name: name, Source: s.dir}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Secret(data), nil
+}
+
+// FileSecretResolver reads secrets from a JSON or YAML file mapping secret names to their values
+type FileSecretResolver struct {
+	path string
+}
+
+var _ SecretResolver = (*FileSecretResolver)(nil)
+
+func NewFileSecretResolver(path string) *FileSecretResolver {
+	return &FileSecretResolver{path: path}
+}
+
+func (s *FileSecretResolver) Resolve(ctx context.Context, name string) (Secret, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := YamlToJson(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets file %s: %v", s.path, err)
+	}
+	values, ok, err := JsonMappify(secrets)
+	if err != nil || !ok {
+		return nil, fmt.Errorf("invalid secrets file %s: no mapping of secret names to values", s.path)
+	}
+	value, ok := values[name]
+	if !ok {
+		return nil, &SecretNotFound{Name: name, Source: s.path}
+	}
+	return Secret(value), nil
+}
+
+// ChainSecretResolver tries its resolvers in order until one of them knows the secret
+type ChainSecretResolver []SecretResolver
+
+var _ SecretResolver = ChainSecretResolver(nil)
+
+func (s ChainSecretResolver) Resolve(ctx context.Context, name string) (Secret, error) {
+	var sources []string
+	for _, resolver := range s {
+		secret, err := resolver.Resolve(ctx, name)
+		var notFound *SecretNotFound
+		if errors.As(err, &notFound) {
+			sources = append(sources, notFound.Source)
+			continue
+		}
+		return secret, err
+	}
+	return nil, &SecretNotFound{Name: name, Source: strings.Join(sources, ", ")}
+}
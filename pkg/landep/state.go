@@ -0,0 +1,281 @@
+package landep
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// InstallationState is the persisted form of an Installation
+type InstallationState struct {
+	Digest    string                              `json:"digest"`
+	PkgName   string                              `json:"pkgName"`
+	Version   string                              `json:"version"`
+	Target    *TargetDescription                  `json:"target"`
+	Requests  map[string]InstallationRequestState `json:"requests"`
+	Parameter Parameter                           `json:"parameter,omitempty"`
+	Response  Response                            `json:"response,omitempty"`
+	Responses map[string]Response                 `json:"responses,omitempty"`
+	Children  []ChildState                        `json:"children,omitempty"`
+}
+
+// ChildState is the persisted form of a Child
+type ChildState struct {
+	Name   string `json:"name"`
+	Stage  int    `json:"stage"`
+	Digest string `json:"digest"`
+}
+
+// InstallationRequestState is the persisted form of an InstallationRequest
+type InstallationRequestState struct {
+	PkgName     string             `json:"pkgName"`
+	Constraints string             `json:"constraints"`
+	Target      *TargetDescription `json:"target,omitempty"`
+	Parameter   Parameter          `json:"parameter,omitempty"`
+}
+
+// StateStore persists the installations of a PackageManager
+type StateStore interface {
+	Load() ([]*InstallationState, error)
+	Save(state *InstallationState) error
+	Delete(digest string) error
+}
+
+func (s *Installation) state() *InstallationState {
+	state := &InstallationState{
+		Digest:    s.Digest,
+		PkgName:   s.PkgName,
+		Target:    s.Target.Description(),
+		Requests:  make(map[string]InstallationRequestState, len(s.Requests)),
+		Parameter: s.Parameter,
+		Response:  s.Response,
+		Responses: make(map[string]Response, len(s.Responses)),
+	}
+	for name, response := range s.Responses {
+		if _, ok := s.secrets[name]; ok {
+			continue
+		}
+		state.Responses[name] = response
+	}
+	if s.Version != nil {
+		state.Version = s.Version.String()
+	}
+	for requester, request := range s.Requests {
+		state.Requests[requester] = request.state()
+	}
+	for _, child := range s.Children {
+		state.Children = append(state.Children, ChildState{Name: child.Name, Stage: child.Stage, Digest: child.Installation.Digest})
+	}
+	return state
+}
+
+func (s *InstallationRequest) state() InstallationRequestState {
+	state := InstallationRequestState{PkgName: s.PkgName, Parameter: s.Parameter}
+	if s.Constraints != nil {
+		state.Constraints = s.Constraints.String()
+	}
+	if s.Target != nil {
+		state.Target = s.Target.Description()
+	}
+	return state
+}
+
+func (s *InstallationRequestState) installationRequest() (InstallationRequest, error) {
+	request := InstallationRequest{PkgName: s.PkgName, Parameter: s.Parameter}
+	if s.Constraints != "" {
+		constraints, err := semver.NewConstraint(s.Constraints)
+		if err != nil {
+			return request, err
+		}
+		request.Constraints = constraints
+	}
+	if s.Target != nil {
+		target, err := NewTarget(s.Target)
+		if err != nil {
+			return request, err
+		}
+		request.Target = target
+	}
+	return request, nil
+}
+
+// resolveCredentials resolves the secrets referenced by the targets of the installation and its requests
+func (s *InstallationState) resolveCredentials(ctx context.Context, secretResolver SecretResolver) error {
+	err := s.Target.resolveCredentials(ctx, secretResolver)
+	if err != nil {
+		return err
+	}
+	for _, request := range s.Requests {
+		err = request.Target.resolveCredentials(ctx, secretResolver)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installationsFromStates recreates installations and links their children
+func installationsFromStates(states []*InstallationState) (map[string]*Installation, error) {
+	installations := make(map[string]*Installation, len(states))
+	for _, state := range states {
+		installations[state.Digest] = &Installation{}
+	}
+	for _, state := range states {
+		err := installations[state.Digest].restore(state, installations)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return installations, nil
+}
+
+// restore resets the installation to the given state. Children are looked up in installations.
+func (s *Installation) restore(state *InstallationState, installations map[string]*Installation) error {
+	target, err := NewTarget(state.Target)
+	if err != nil {
+		return fmt.Errorf("invalid target of installation %s: %v", state.Digest, err)
+	}
+	var version *semver.Version
+	if state.Version != "" {
+		version, err = semver.NewVersion(state.Version)
+		if err != nil {
+			return fmt.Errorf("invalid version of installation %s: %v", state.Digest, err)
+		}
+	}
+	requests := make(map[string]InstallationRequest, len(state.Requests))
+	for requester, requestState := range state.Requests {
+		requests[requester], err = requestState.installationRequest()
+		if err != nil {
+			return fmt.Errorf("invalid request %s of installation %s: %v", requester, state.Digest, err)
+		}
+	}
+	var children []*Child
+	for _, childState := range state.Children {
+		child, ok := installations[childState.Digest]
+		if !ok {
+			return fmt.Errorf("child %s of installation %s not found", childState.Digest, state.Digest)
+		}
+		children = append(children, &Child{Name: childState.Name, Stage: childState.Stage, Installation: child})
+	}
+	responses := make(map[string]Response, len(state.Responses))
+	for name, response := range state.Responses {
+		responses[name] = response
+	}
+	s.PkgName = state.PkgName
+	s.Target = target
+	s.Digest = state.Digest
+	s.Version = version
+	s.Parameter = state.Parameter
+	s.Response = state.Response
+	s.Requests = requests
+	s.Responses = responses
+	s.Children = children
+	s.secrets = nil
+	return nil
+}
+
+// FileStateStore stores all installations as JSON in a single file. The file isn't redacted, because
+// installations are reapplied with their parameters and responses. It's written with mode 0600.
+type FileStateStore struct {
+	path  string
+	mutex sync.Mutex
+}
+
+var _ StateStore = (*FileStateStore)(nil)
+
+func NewFileStateStore(path string) *FileStateStore {
+	return &FileStateStore{path: path}
+}
+
+func (s *FileStateStore) read() (map[string]*InstallationState, error) {
+	states := map[string]*InstallationState{}
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return states, nil
+	}
+	err = json.Unmarshal(data, &states)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", s.path, err)
+	}
+	return states, nil
+}
+
+func (s *FileStateStore) write(states map[string]*InstallationState) error {
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(s.path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *FileStateStore) Load() ([]*InstallationState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	states, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*InstallationState, 0, len(states))
+	for _, state := range states {
+		result = append(result, state)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Digest < result[j].Digest
+	})
+	return result, nil
+}
+
+func (s *FileStateStore) Save(state *InstallationState) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	states, err := s.read()
+	if err != nil {
+		return err
+	}
+	states[state.Digest] = state
+	return s.write(states)
+}
+
+func (s *FileStateStore) Delete(digest string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	states, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := states[digest]; !ok {
+		return nil
+	}
+	delete(states, digest)
+	return s.write(states)
+}
@@ -0,0 +1,13 @@
+package landep
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestLandep(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Landep Suite")
+}
@@ -1,7 +1,11 @@
 package landep
 
 import (
+	"context"
+	"crypto/md5"
 	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/Masterminds/semver/v3"
 )
@@ -11,44 +15,212 @@ type BasicAuthorization struct {
 	Password string `json:"password"`
 }
 
+// Credentials authenticate at URL. Basic credentials resolved from the secret SecretRef aren't marshalled,
+// only the reference is.
 type Credentials struct {
-	URL   string             `json:"url"`
-	Basic BasicAuthorization `json:"basic"`
+	URL       string             `json:"url"`
+	Basic     BasicAuthorization `json:"basic"`
+	SecretRef string             `json:"secretRef,omitempty"`
+}
+
+func (s Credentials) MarshalJSON() ([]byte, error) {
+	if s.SecretRef == "" {
+		type credentials Credentials
+		return json.Marshal(credentials(s))
+	}
+	return json.Marshal(struct {
+		URL       string `json:"url"`
+		SecretRef string `json:"secretRef"`
+	}{URL: s.URL, SecretRef: s.SecretRef})
 }
 
 type Target interface {
 	Digest() []byte
+	Description() *TargetDescription
+}
+
+const (
+	K8sTargetKind                     = "k8s"
+	CloudFoundryTargetKind            = "cloudfoundry"
+	K8sCloudFoundryBridgingTargetKind = "k8s-cloudfoundry-bridging"
+)
+
+// TargetDescription is the serializable form of a Target. It is used to persist
+// installations and to recreate their targets using the target factory.
+type TargetDescription struct {
+	Kind               string              `json:"kind"`
+	Namespace          string              `json:"namespace,omitempty"`
+	K8sConfig          *K8sConfig          `json:"k8s,omitempty"`
+	CloudFoundryConfig *CloudFoundryConfig `json:"cloudFoundry,omitempty"`
+}
+
+// Helm release states
+const (
+	ReleaseStatusDeployed   = "deployed"
+	ReleaseStatusSuperseded = "superseded"
+	ReleaseStatusFailed     = "failed"
+)
+
+// ReleaseStatus describes the current revision of a helm release
+type ReleaseStatus struct {
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace"`
+	Revision     int    `json:"revision"`
+	Status       string `json:"status"`
+	Chart        string `json:"chart"`
+	ChartVersion string `json:"chartVersion"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Deployed reports whether the last apply of the release succeeded
+func (s *ReleaseStatus) Deployed() bool {
+	return s.Status == ReleaseStatusDeployed
+}
+
+// ReleaseRevision is an entry of the history of a helm release. Chart contains name and version of the chart.
+type ReleaseRevision struct {
+	Revision    int    `json:"revision"`
+	Updated     string `json:"updated"`
+	Status      string `json:"status"`
+	Chart       string `json:"chart"`
+	AppVersion  string `json:"app_version"`
+	Description string `json:"description"`
 }
 
+// Helm installs charts as releases. The queries return a ReleaseNotFound error for unknown releases.
 type Helm interface {
-	Apply(name string, chart string, version *semver.Version, parameter json.RawMessage) error
-	Delete(name string) error
+	Apply(ctx context.Context, name string, chart string, version *semver.Version, parameter json.RawMessage) error
+	Delete(ctx context.Context, name string) error
+	Status(ctx context.Context, name string) (*ReleaseStatus, error)
+	// GetValues returns the values passed with the last apply
+	GetValues(ctx context.Context, name string) (json.RawMessage, error)
+	// History returns the revisions of the release, the oldest first
+	History(ctx context.Context, name string) ([]ReleaseRevision, error)
+	// Rollback creates a new revision of the release using chart and values of the given revision
+	Rollback(ctx context.Context, name string, revision int) error
+}
+
+// KappAppStatus describes the resources of a deployed kapp application
+type KappAppStatus struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// Resources contains the resources of the app as Kind/name
+	Resources []string `json:"resources,omitempty"`
+	// Failing contains the resources which aren't reconciled successfully
+	Failing []string `json:"failing,omitempty"`
 }
 
 type Kapp interface {
-	Apply(name string, chart string, version *semver.Version, parameter json.RawMessage) error
-	Delete(name string) error
+	Apply(ctx context.Context, name string, chart string, version *semver.Version, parameter json.RawMessage) error
+	Delete(ctx context.Context, name string) error
+	// Status returns a KappAppNotFound error for unknown apps
+	Status(ctx context.Context, name string) (*KappAppStatus, error)
+}
+
+// Manifests deploys plain kubernetes manifests. All objects are labeled with the installation name,
+// objects of the installation which aren't part of the manifests anymore are pruned.
+type Manifests interface {
+	// Apply applies YAML or JSON documents
+	Apply(ctx context.Context, name string, manifests []byte) error
+	// ApplyKustomization applies the manifests built by kustomize from the directory
+	ApplyKustomization(ctx context.Context, name string, directory string) error
+	Delete(ctx context.Context, name string) error
 }
 
 type K8sConfig struct {
-	URL string `json "url"`
+	URL string `json:"url"`
+	// Kubeconfig is the path of the kubeconfig file used by helm and kapp
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// Context selects a context of the kubeconfig
+	Context string `json:"context,omitempty"`
+	// KeepNamespaces lists namespaces which are shared with others and therefore never deleted
+	KeepNamespaces []string `json:"keepNamespaces,omitempty"`
 }
+
+// keepNamespace reports whether the namespace must survive the deletion of its last installation
+func (s *K8sConfig) keepNamespace(namespace string) bool {
+	for _, keep := range s.KeepNamespaces {
+		if keep == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// K8sTarget deploys into a namespace. Helm, Kapp and Manifests ensure that the namespace exists before applying.
 type K8sTarget interface {
 	Target
 	Helm() Helm
 	Kapp() Kapp
+	Manifests() Manifests
 	Config() *K8sConfig
+	// EnsureNamespace creates the namespace unless it exists. It is labeled with the installation creating it.
+	EnsureNamespace(ctx context.Context, installation string) error
+	// DeleteNamespace deletes the namespace if it was created by EnsureNamespace
+	DeleteNamespace(ctx context.Context) error
 }
 
 type CloudFoundryConfig struct {
-	CloudFoundryCredentials Credentials `json "cf"`
-	UAACredentials          Credentials `json "uaa"`
+	CloudFoundryCredentials Credentials `json:"cf"`
+	UAACredentials          Credentials `json:"uaa"`
+}
+
+// CloudFoundryRole is the type of a role of a user in an org or a space
+type CloudFoundryRole string
+
+const (
+	OrganizationUserRole           CloudFoundryRole = "organization_user"
+	OrganizationAuditorRole        CloudFoundryRole = "organization_auditor"
+	OrganizationManagerRole        CloudFoundryRole = "organization_manager"
+	OrganizationBillingManagerRole CloudFoundryRole = "organization_billing_manager"
+	SpaceAuditorRole               CloudFoundryRole = "space_auditor"
+	SpaceDeveloperRole             CloudFoundryRole = "space_developer"
+	SpaceManagerRole               CloudFoundryRole = "space_manager"
+	SpaceSupporterRole             CloudFoundryRole = "space_supporter"
+)
+
+// CloudFoundryQuota limits the resources of an org or a space. Zero values are unlimited.
+type CloudFoundryQuota struct {
+	TotalMemoryInMB       int `json:"totalMemoryInMB,omitempty"`
+	TotalServiceInstances int `json:"totalServiceInstances,omitempty"`
+	TotalRoutes           int `json:"totalRoutes,omitempty"`
+}
+
+// ServiceBroker describes the registration of a service broker. Brokers with a space are only
+// visible in this space of the org.
+type ServiceBroker struct {
+	Name        string
+	URL         string
+	Credentials BasicAuthorization
+	Org         string
+	Space       string
 }
 
+// CloudFoundryTarget manages orgs, spaces and service brokers. All operations are idempotent.
+// Spaces and service brokers are deleted by name only, because installers get nothing else on deletion.
 type CloudFoundryTarget interface {
 	Target
-	CreateOrg(name string, user string) error
-	DeleteOrg(name string) error
+	// CreateOrg creates the org and makes user its manager
+	CreateOrg(ctx context.Context, name string, user string) error
+	// DeleteOrg deletes the org including its spaces and its quota
+	DeleteOrg(ctx context.Context, name string) error
+	CreateSpace(ctx context.Context, org string, name string) error
+	DeleteSpace(ctx context.Context, name string) error
+	// SetOrgQuota assigns the org a quota named like the org
+	SetOrgQuota(ctx context.Context, org string, quota CloudFoundryQuota) error
+	// SetSpaceQuota assigns the space a quota named like the space
+	SetSpaceQuota(ctx context.Context, org string, space string, quota CloudFoundryQuota) error
+	AssignOrgRole(ctx context.Context, org string, user string, role CloudFoundryRole) error
+	AssignSpaceRole(ctx context.Context, org string, space string, user string, role CloudFoundryRole) error
+	// RegisterServiceBroker registers the broker or updates its URL and credentials
+	RegisterServiceBroker(ctx context.Context, broker ServiceBroker) error
+	DeleteServiceBroker(ctx context.Context, name string) error
+	// EnableServiceAccess makes all plans of the broker visible in the orgs, or public if no org is given
+	EnableServiceAccess(ctx context.Context, broker string, orgs []string) error
+	OrgExists(ctx context.Context, name string) (bool, error)
+	SpaceExists(ctx context.Context, org string, name string) (bool, error)
+	// ServiceBrokerURL returns the URL of the broker or an empty string if the broker isn't registered
+	ServiceBrokerURL(ctx context.Context, name string) (string, error)
 	Config() *CloudFoundryConfig
 }
 
@@ -77,3 +249,119 @@ func NewCloudFoundryTarget(credentials *CloudFoundryConfig) CloudFoundryTarget {
 func NewK8sCloudFoundryBridgingTarget(k8s K8sTarget, cf CloudFoundryTarget) K8sCloudFoundryBridgingTarget {
 	return tf.K8sCloudFoundryBridgingTarget(k8s, cf)
 }
+
+func NewTarget(description *TargetDescription) (Target, error) {
+	switch description.Kind {
+	case K8sTargetKind:
+		if description.K8sConfig == nil {
+			return nil, fmt.Errorf("target of kind %s requires a k8s config", description.Kind)
+		}
+		return NewK8sTarget(description.Namespace, description.K8sConfig), nil
+	case CloudFoundryTargetKind:
+		if description.CloudFoundryConfig == nil {
+			return nil, fmt.Errorf("target of kind %s requires a cloud foundry config", description.Kind)
+		}
+		return NewCloudFoundryTarget(description.CloudFoundryConfig), nil
+	case K8sCloudFoundryBridgingTargetKind:
+		if description.K8sConfig == nil || description.CloudFoundryConfig == nil {
+			return nil, fmt.Errorf("target of kind %s requires a k8s and a cloud foundry config", description.Kind)
+		}
+		return NewK8sCloudFoundryBridgingTarget(
+			NewK8sTarget(description.Namespace, description.K8sConfig),
+			NewCloudFoundryTarget(description.CloudFoundryConfig)), nil
+	}
+	return nil, fmt.Errorf("unknown target kind %s", description.Kind)
+}
+
+// k8sTargetOf returns the k8s target of k8s and bridging targets
+func k8sTargetOf(target Target) (K8sTarget, bool) {
+	switch t := target.(type) {
+	case K8sCloudFoundryBridgingTarget:
+		return t.K8sTarget(), true
+	case K8sTarget:
+		return t, true
+	}
+	return nil, false
+}
+
+func k8sTargetDigest(namespace string, config *K8sConfig) []byte {
+	hash := md5.New()
+	hash.Write([]byte(namespace))
+	hash.Write([]byte(config.URL))
+	return hash.Sum(nil)
+}
+
+func cloudFoundryTargetDigest(config *CloudFoundryConfig) []byte {
+	hash := md5.New()
+	hash.Write([]byte(config.CloudFoundryCredentials.URL))
+	hash.Write([]byte(config.UAACredentials.URL))
+	return hash.Sum(nil)
+}
+
+// k8sCloudFoundryBridgingTarget combines a k8s and a cloud foundry target of any target factory
+type k8sCloudFoundryBridgingTarget struct {
+	k8sTarget          K8sTarget
+	cloudFoundryTarget CloudFoundryTarget
+}
+
+func (s k8sCloudFoundryBridgingTarget) Digest() []byte {
+	hash := md5.New()
+	hash.Write(s.k8sTarget.Digest())
+	hash.Write(s.cloudFoundryTarget.Digest())
+	return hash.Sum(nil)
+}
+
+func (s k8sCloudFoundryBridgingTarget) Description() *TargetDescription {
+	k8s := s.k8sTarget.Description()
+	return &TargetDescription{
+		Kind:               K8sCloudFoundryBridgingTargetKind,
+		Namespace:          k8s.Namespace,
+		K8sConfig:          k8s.K8sConfig,
+		CloudFoundryConfig: s.cloudFoundryTarget.Description().CloudFoundryConfig,
+	}
+}
+
+func (s k8sCloudFoundryBridgingTarget) K8sTarget() K8sTarget {
+	return s.k8sTarget
+}
+
+func (s k8sCloudFoundryBridgingTarget) CloudFoundryTarget() CloudFoundryTarget {
+	return s.cloudFoundryTarget
+}
+
+func (s CloudFoundryQuota) String() string {
+	limit := func(value int, unit string) string {
+		if value == 0 {
+			return "unlimited"
+		}
+		return fmt.Sprintf("%d%s", value, unit)
+	}
+	return fmt.Sprintf("-m %s -s %s -r %s", limit(s.TotalMemoryInMB, "M"), limit(s.TotalServiceInstances, ""), limit(s.TotalRoutes, ""))
+}
+
+// String describes the registration as cf command. The credentials are omitted.
+func (s ServiceBroker) String() string {
+	if s.Space != "" {
+		return fmt.Sprintf("cf create service broker %s %s --space-scoped -o %s -s %s", s.Name, s.URL, s.Org, s.Space)
+	}
+	return fmt.Sprintf("cf create service broker %s %s", s.Name, s.URL)
+}
+
+func serviceAccessString(broker string, orgs []string) string {
+	if len(orgs) == 0 {
+		return fmt.Sprintf("cf enable service access -b %s", broker)
+	}
+	return fmt.Sprintf("cf enable service access -b %s -o %s", broker, strings.Join(orgs, ","))
+}
+
+func (s *TargetDescription) String() string {
+	switch s.Kind {
+	case K8sTargetKind:
+		return fmt.Sprintf("%s(%s, namespace %s)", s.Kind, s.K8sConfig.URL, s.Namespace)
+	case CloudFoundryTargetKind:
+		return fmt.Sprintf("%s(%s)", s.Kind, s.CloudFoundryConfig.CloudFoundryCredentials.URL)
+	case K8sCloudFoundryBridgingTargetKind:
+		return fmt.Sprintf("%s(%s, namespace %s, %s)", s.Kind, s.K8sConfig.URL, s.Namespace, s.CloudFoundryConfig.CloudFoundryCredentials.URL)
+	}
+	return s.Kind
+}
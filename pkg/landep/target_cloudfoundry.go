@@ -0,0 +1,559 @@
+package landep
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CloudFoundryError is returned if the cloud controller or UAA rejects a request
+type CloudFoundryError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Errors     []CloudFoundryErrorDetail
+}
+
+// CloudFoundryErrorDetail is an entry of the errors returned by the cloud controller v3 API
+type CloudFoundryErrorDetail struct {
+	Code   int    `json:"code"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+func (d CloudFoundryError) Error() string {
+	details := make([]string, 0, len(d.Errors))
+	for _, e := range d.Errors {
+		details = append(details, fmt.Sprintf("%s (%d): %s", e.Title, e.Code, e.Detail))
+	}
+	return fmt.Sprintf("%s %s failed with status %d: %s", d.Method, d.URL, d.StatusCode, strings.Join(details, ", "))
+}
+
+var _ error = (*CloudFoundryError)(nil)
+
+// cloudFoundryTarget calls the cloud controller v3 API. Resources are looked up by name before they
+// are created or deleted, which makes all operations idempotent. Users authenticate with the password grant,
+// the UAA credentials are the OAuth client.
+type cloudFoundryTarget struct {
+	config       *CloudFoundryConfig
+	client       *http.Client
+	pollInterval time.Duration
+	mutex        sync.Mutex
+	token        string
+	expiry       time.Time
+}
+
+var _ CloudFoundryTarget = (*cloudFoundryTarget)(nil)
+
+func (s *cloudFoundryTarget) Config() *CloudFoundryConfig {
+	return s.config
+}
+
+func (s *cloudFoundryTarget) Description() *TargetDescription {
+	return &TargetDescription{Kind: CloudFoundryTargetKind, CloudFoundryConfig: s.config}
+}
+
+func (s *cloudFoundryTarget) Digest() []byte {
+	return cloudFoundryTargetDigest(s.config)
+}
+
+type cloudFoundryResource struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+	// URL is only set for service brokers
+	URL string `json:"url,omitempty"`
+}
+
+type cloudFoundryJob struct {
+	GUID   string                    `json:"guid"`
+	State  string                    `json:"state"`
+	Errors []CloudFoundryErrorDetail `json:"errors"`
+}
+
+type cloudFoundryRelationship struct {
+	Data interface{} `json:"data"`
+}
+
+type cloudFoundryGUID struct {
+	GUID string `json:"guid"`
+}
+
+// CreateOrg creates the organization unless it exists and makes user its manager
+func (s *cloudFoundryTarget) CreateOrg(ctx context.Context, name string, user string) error {
+	org, err := s.find(ctx, "/v3/organizations", name, nil)
+	if err != nil {
+		return err
+	}
+	if org == nil {
+		org, err = s.create(ctx, "/v3/organizations", name, map[string]interface{}{"name": name}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if user == "" {
+		return nil
+	}
+	return s.assignRole(ctx, "organization", org.GUID, user, OrganizationManagerRole)
+}
+
+// DeleteOrg deletes the organization and its quota if they exist and waits for the deletion jobs
+func (s *cloudFoundryTarget) DeleteOrg(ctx context.Context, name string) error {
+	err := s.delete(ctx, "/v3/organizations", name, nil)
+	if err != nil {
+		return err
+	}
+	return s.delete(ctx, "/v3/organization_quotas", name, nil)
+}
+
+func (s *cloudFoundryTarget) CreateSpace(ctx context.Context, org string, name string) error {
+	orgGUID, err := s.orgGUID(ctx, org)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"organization_guids": {orgGUID}}
+	space, err := s.find(ctx, "/v3/spaces", name, query)
+	if err != nil || space != nil {
+		return err
+	}
+	_, err = s.create(ctx, "/v3/spaces", name, map[string]interface{}{
+		"name":          name,
+		"relationships": map[string]interface{}{"organization": cloudFoundryRelationship{Data: cloudFoundryGUID{orgGUID}}},
+	}, query)
+	return err
+}
+
+func (s *cloudFoundryTarget) DeleteSpace(ctx context.Context, name string) error {
+	return s.delete(ctx, "/v3/spaces", name, nil)
+}
+
+func (s *cloudFoundryTarget) SetOrgQuota(ctx context.Context, org string, quota CloudFoundryQuota) error {
+	orgGUID, err := s.orgGUID(ctx, org)
+	if err != nil {
+		return err
+	}
+	quotaGUID, err := s.setQuota(ctx, "/v3/organization_quotas", org, quota, nil, nil)
+	if err != nil {
+		return err
+	}
+	return s.do(ctx, http.MethodPost, "/v3/organization_quotas/"+quotaGUID+"/relationships/organizations",
+		cloudFoundryRelationship{Data: []cloudFoundryGUID{{orgGUID}}}, nil)
+}
+
+func (s *cloudFoundryTarget) SetSpaceQuota(ctx context.Context, org string, space string, quota CloudFoundryQuota) error {
+	orgGUID, spaceGUID, err := s.spaceGUID(ctx, org, space)
+	if err != nil {
+		return err
+	}
+	quotaGUID, err := s.setQuota(ctx, "/v3/space_quotas", space, quota, url.Values{"organization_guids": {orgGUID}},
+		map[string]interface{}{"organization": cloudFoundryRelationship{Data: cloudFoundryGUID{orgGUID}}})
+	if err != nil {
+		return err
+	}
+	return s.do(ctx, http.MethodPost, "/v3/space_quotas/"+quotaGUID+"/relationships/spaces",
+		cloudFoundryRelationship{Data: []cloudFoundryGUID{{spaceGUID}}}, nil)
+}
+
+func (s *cloudFoundryTarget) AssignOrgRole(ctx context.Context, org string, user string, role CloudFoundryRole) error {
+	orgGUID, err := s.orgGUID(ctx, org)
+	if err != nil {
+		return err
+	}
+	return s.assignRole(ctx, "organization", orgGUID, user, role)
+}
+
+func (s *cloudFoundryTarget) AssignSpaceRole(ctx context.Context, org string, space string, user string, role CloudFoundryRole) error {
+	orgGUID, spaceGUID, err := s.spaceGUID(ctx, org, space)
+	if err != nil {
+		return err
+	}
+	// users need a role in the org to get one in its spaces
+	err = s.assignRole(ctx, "organization", orgGUID, user, OrganizationUserRole)
+	if err != nil {
+		return err
+	}
+	return s.assignRole(ctx, "space", spaceGUID, user, role)
+}
+
+func (s *cloudFoundryTarget) RegisterServiceBroker(ctx context.Context, broker ServiceBroker) error {
+	body := map[string]interface{}{
+		"url": broker.URL,
+		"authentication": map[string]interface{}{
+			"type":        "basic",
+			"credentials": broker.Credentials,
+		},
+	}
+	existing, err := s.find(ctx, "/v3/service_brokers", broker.Name, nil)
+	if err != nil {
+		return err
+	}
+	var job string
+	if existing != nil {
+		job, err = s.doAsync(ctx, http.MethodPatch, "/v3/service_brokers/"+existing.GUID, body)
+	} else {
+		body["name"] = broker.Name
+		if broker.Space != "" {
+			_, spaceGUID, err := s.spaceGUID(ctx, broker.Org, broker.Space)
+			if err != nil {
+				return err
+			}
+			body["relationships"] = map[string]interface{}{"space": cloudFoundryRelationship{Data: cloudFoundryGUID{spaceGUID}}}
+		}
+		job, err = s.doAsync(ctx, http.MethodPost, "/v3/service_brokers", body)
+	}
+	if err != nil {
+		return err
+	}
+	return s.waitForJob(ctx, job)
+}
+
+func (s *cloudFoundryTarget) DeleteServiceBroker(ctx context.Context, name string) error {
+	return s.delete(ctx, "/v3/service_brokers", name, nil)
+}
+
+func (s *cloudFoundryTarget) EnableServiceAccess(ctx context.Context, broker string, orgs []string) error {
+	visibility := map[string]interface{}{"type": "public"}
+	if len(orgs) != 0 {
+		organizations := make([]cloudFoundryGUID, 0, len(orgs))
+		for _, org := range orgs {
+			orgGUID, err := s.orgGUID(ctx, org)
+			if err != nil {
+				return err
+			}
+			organizations = append(organizations, cloudFoundryGUID{orgGUID})
+		}
+		visibility = map[string]interface{}{"type": "organization", "organizations": organizations}
+	}
+	var plans struct {
+		Resources []cloudFoundryResource `json:"resources"`
+	}
+	query := url.Values{"service_broker_names": {broker}, "per_page": {"5000"}}
+	err := s.do(ctx, http.MethodGet, "/v3/service_plans?"+query.Encode(), nil, &plans)
+	if err != nil {
+		return err
+	}
+	for _, plan := range plans.Resources {
+		// organizations are added by POST, public visibility replaces them
+		method := http.MethodPost
+		if len(orgs) == 0 {
+			method = http.MethodPatch
+		}
+		err = s.do(ctx, method, "/v3/service_plans/"+plan.GUID+"/visibility", visibility, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *cloudFoundryTarget) OrgExists(ctx context.Context, name string) (bool, error) {
+	org, err := s.find(ctx, "/v3/organizations", name, nil)
+	return org != nil, err
+}
+
+func (s *cloudFoundryTarget) SpaceExists(ctx context.Context, org string, name string) (bool, error) {
+	orgResource, err := s.find(ctx, "/v3/organizations", org, nil)
+	if err != nil || orgResource == nil {
+		return false, err
+	}
+	space, err := s.find(ctx, "/v3/spaces", name, url.Values{"organization_guids": {orgResource.GUID}})
+	return space != nil, err
+}
+
+func (s *cloudFoundryTarget) ServiceBrokerURL(ctx context.Context, name string) (string, error) {
+	broker, err := s.find(ctx, "/v3/service_brokers", name, nil)
+	if err != nil || broker == nil {
+		return "", err
+	}
+	return broker.URL, nil
+}
+
+func (s *cloudFoundryTarget) assignRole(ctx context.Context, scope string, guid string, user string, role CloudFoundryRole) error {
+	body := map[string]interface{}{
+		"type": role,
+		"relationships": map[string]interface{}{
+			"user": cloudFoundryRelationship{Data: map[string]string{"username": user}},
+			scope:  cloudFoundryRelationship{Data: cloudFoundryGUID{guid}},
+		},
+	}
+	err := s.do(ctx, http.MethodPost, "/v3/roles", body, nil)
+	if hasStatus(err, http.StatusUnprocessableEntity) && strings.Contains(err.Error(), "already has") {
+		return nil
+	}
+	return err
+}
+
+// setQuota creates or updates the quota with the given name and returns its guid
+func (s *cloudFoundryTarget) setQuota(ctx context.Context, path string, name string, quota CloudFoundryQuota, query url.Values, relationships map[string]interface{}) (string, error) {
+	limit := func(value int) interface{} {
+		if value == 0 {
+			return nil
+		}
+		return value
+	}
+	body := map[string]interface{}{
+		"apps":     map[string]interface{}{"total_memory_in_mb": limit(quota.TotalMemoryInMB)},
+		"services": map[string]interface{}{"total_service_instances": limit(quota.TotalServiceInstances)},
+		"routes":   map[string]interface{}{"total_routes": limit(quota.TotalRoutes)},
+	}
+	existing, err := s.find(ctx, path, name, query)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return existing.GUID, s.do(ctx, http.MethodPatch, path+"/"+existing.GUID, body, nil)
+	}
+	body["name"] = name
+	if relationships != nil {
+		body["relationships"] = relationships
+	}
+	created, err := s.create(ctx, path, name, body, query)
+	if err != nil {
+		return "", err
+	}
+	return created.GUID, nil
+}
+
+func (s *cloudFoundryTarget) orgGUID(ctx context.Context, name string) (string, error) {
+	org, err := s.find(ctx, "/v3/organizations", name, nil)
+	if err != nil {
+		return "", err
+	}
+	if org == nil {
+		return "", fmt.Errorf("organization %s not found", name)
+	}
+	return org.GUID, nil
+}
+
+func (s *cloudFoundryTarget) spaceGUID(ctx context.Context, org string, name string) (string, string, error) {
+	orgGUID, err := s.orgGUID(ctx, org)
+	if err != nil {
+		return "", "", err
+	}
+	space, err := s.find(ctx, "/v3/spaces", name, url.Values{"organization_guids": {orgGUID}})
+	if err != nil {
+		return "", "", err
+	}
+	if space == nil {
+		return "", "", fmt.Errorf("space %s not found in organization %s", name, org)
+	}
+	return orgGUID, space.GUID, nil
+}
+
+// find looks up the resource with the given name. It returns nil if it doesn't exist.
+func (s *cloudFoundryTarget) find(ctx context.Context, path string, name string, query url.Values) (*cloudFoundryResource, error) {
+	var page struct {
+		Resources []cloudFoundryResource `json:"resources"`
+	}
+	values := url.Values{"names": {name}}
+	for key, value := range query {
+		values[key] = value
+	}
+	err := s.do(ctx, http.MethodGet, path+"?"+values.Encode(), nil, &page)
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range page.Resources {
+		if resource.Name == name {
+			return &resource, nil
+		}
+	}
+	return nil, nil
+}
+
+// create creates a resource. If it was created concurrently, the existing resource is returned.
+func (s *cloudFoundryTarget) create(ctx context.Context, path string, name string, body interface{}, query url.Values) (*cloudFoundryResource, error) {
+	created := &cloudFoundryResource{}
+	err := s.do(ctx, http.MethodPost, path, body, created)
+	if !hasStatus(err, http.StatusUnprocessableEntity) {
+		return created, err
+	}
+	existing, findErr := s.find(ctx, path, name, query)
+	if findErr != nil || existing == nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// delete deletes the resource with the given name if it exists and waits for the deletion job
+func (s *cloudFoundryTarget) delete(ctx context.Context, path string, name string, query url.Values) error {
+	resource, err := s.find(ctx, path, name, query)
+	if err != nil || resource == nil {
+		return err
+	}
+	job, err := s.doAsync(ctx, http.MethodDelete, path+"/"+resource.GUID, nil)
+	if hasStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.waitForJob(ctx, job)
+}
+
+func (s *cloudFoundryTarget) waitForJob(ctx context.Context, location string) error {
+	if location == "" {
+		return nil
+	}
+	for {
+		var job cloudFoundryJob
+		err := s.do(ctx, http.MethodGet, location, nil, &job)
+		if err != nil {
+			return err
+		}
+		switch job.State {
+		case "COMPLETE":
+			return nil
+		case "FAILED":
+			return &CloudFoundryError{Method: http.MethodGet, URL: location, StatusCode: http.StatusOK, Errors: job.Errors}
+		}
+		timer := time.NewTimer(s.pollInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// do sends a request to the cloud controller. path may be an absolute URL, e.g. of a job.
+func (s *cloudFoundryTarget) do(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	response, err := s.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if result == nil {
+		io.Copy(ioutil.Discard, response.Body)
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// doAsync sends a request and returns the location of the job executing it asynchronously
+func (s *cloudFoundryTarget) doAsync(ctx context.Context, method string, path string, body interface{}) (string, error) {
+	response, err := s.request(ctx, method, path, body)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode != http.StatusAccepted {
+		return "", nil
+	}
+	return response.Header.Get("Location"), nil
+}
+
+func (s *cloudFoundryTarget) request(ctx context.Context, method string, path string, body interface{}) (*http.Response, error) {
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	target := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		target = strings.TrimSuffix(s.config.CloudFoundryCredentials.URL, "/") + path
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	return s.send(request)
+}
+
+// send executes the request. Failures of the server are Retryable.
+func (s *cloudFoundryTarget) send(request *http.Request) (*http.Response, error) {
+	response, err := s.client.Do(request)
+	if err != nil {
+		if request.Context().Err() != nil {
+			return nil, request.Context().Err()
+		}
+		return nil, NewRetryable(err)
+	}
+	if response.StatusCode < 300 {
+		return response, nil
+	}
+	defer response.Body.Close()
+	cfError := &CloudFoundryError{Method: request.Method, URL: request.URL.String(), StatusCode: response.StatusCode}
+	var payload struct {
+		Errors []CloudFoundryErrorDetail `json:"errors"`
+	}
+	if json.NewDecoder(response.Body).Decode(&payload) == nil {
+		cfError.Errors = payload.Errors
+	}
+	if response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests {
+		return nil, NewRetryable(cfError)
+	}
+	return nil, cfError
+}
+
+// accessToken returns a cached token or fetches a new one from UAA
+func (s *cloudFoundryTarget) accessToken(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token != "" && time.Now().Before(s.expiry) {
+		return s.token, nil
+	}
+	form := url.Values{}
+	user := s.config.CloudFoundryCredentials.Basic
+	if user.Username != "" {
+		form.Set("grant_type", "password")
+		form.Set("username", user.Username)
+		form.Set("password", user.Password)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(s.config.UAACredentials.URL, "/")+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(s.config.UAACredentials.Basic.Username, s.config.UAACredentials.Basic.Password)
+	response, err := s.send(request)
+	if err != nil {
+		return "", fmt.Errorf("authentication at %s failed: %w", s.config.UAACredentials.URL, err)
+	}
+	defer response.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&token)
+	if err != nil {
+		return "", fmt.Errorf("invalid token response of %s: %v", s.config.UAACredentials.URL, err)
+	}
+	redactorFrom(ctx).Register(token.AccessToken)
+	s.token = token.AccessToken
+	// renew tokens shortly before they expire
+	s.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - 30*time.Second)
+	return s.token, nil
+}
+
+func hasStatus(err error, statusCode int) bool {
+	var cfError *CloudFoundryError
+	return errors.As(err, &cfError) && cfError.StatusCode == statusCode
+}
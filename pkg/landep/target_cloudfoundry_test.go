@@ -0,0 +1,379 @@
+package landep
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeCloudController stands in for UAA and the cloud controller v3 API. Resources are kept by collection and guid.
+type fakeCloudController struct {
+	mutex     sync.Mutex
+	resources map[string]map[string]string
+	roles     map[string]bool
+	jobs      map[string]int
+	bodies    map[string]map[string]interface{}
+	// urls contains the URLs of the service brokers by guid
+	urls     map[string]string
+	requests []string
+	failures int
+	tokens   int
+}
+
+func newFakeCloudController() *fakeCloudController {
+	return &fakeCloudController{
+		resources: map[string]map[string]string{},
+		roles:     map[string]bool{},
+		jobs:      map[string]int{},
+		bodies:    map[string]map[string]interface{}{},
+		urls:      map[string]string{},
+	}
+}
+
+// startJob creates a job which completes after two polls
+func (s *fakeCloudController) startJob(w http.ResponseWriter, r *http.Request, guid string) {
+	s.jobs[guid] = 2
+	w.Header().Set("Location", "http://"+r.Host+"/v3/jobs/"+guid)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *fakeCloudController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	request := r.Method + " " + r.URL.Path
+	s.requests = append(s.requests, request)
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/oauth/token" {
+		username, password, _ := r.BasicAuth()
+		if username != "cf" || password != "" || r.FormValue("grant_type") != "password" ||
+			r.FormValue("username") != "admin" || r.FormValue("password") != "admin-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.tokens++
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":3600}`, s.tokens)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer token-") {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"errors":[{"code":10015,"title":"CF-ServiceUnavailable","detail":"try again"}]}`)
+		return
+	}
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	if body != nil {
+		s.bodies[request] = body
+	}
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/v3/"), "/")
+	collection := path[0]
+	switch {
+	case collection == "roles":
+		relationships := body["relationships"].(map[string]interface{})
+		key := body["type"].(string)
+		for _, scope := range []string{"organization", "space", "user"} {
+			if relationship, ok := relationships[scope]; ok {
+				data := relationship.(map[string]interface{})["data"].(map[string]interface{})
+				if guid, ok := data["guid"]; ok {
+					key += fmt.Sprintf(" %v", guid)
+				} else {
+					key += fmt.Sprintf(" %v", data["username"])
+				}
+			}
+		}
+		if s.roles[key] {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprintf(w, `{"errors":[{"code":10008,"title":"CF-UnprocessableEntity","detail":"User already has '%s' role"}]}`, body["type"])
+			return
+		}
+		s.roles[key] = true
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"guid":"role"}`)
+	case collection == "jobs":
+		guid := path[1]
+		if guid == "guid-undeletable" {
+			fmt.Fprint(w, `{"guid":"job","state":"FAILED","errors":[{"code":10008,"title":"CF-UnprocessableEntity","detail":"org not empty"}]}`)
+			return
+		}
+		s.jobs[guid]--
+		if s.jobs[guid] > 0 {
+			fmt.Fprint(w, `{"guid":"job","state":"PROCESSING"}`)
+		} else {
+			fmt.Fprint(w, `{"guid":"job","state":"COMPLETE"}`)
+		}
+	case collection == "service_plans" && len(path) == 1:
+		fmt.Fprintf(w, `{"resources":[{"guid":"plan-%s","name":"default"}]}`, r.URL.Query().Get("service_broker_names"))
+	case len(path) > 1 && (path[len(path)-1] == "visibility" || path[len(path)-2] == "relationships"):
+		fmt.Fprint(w, `{}`)
+	case r.Method == http.MethodGet && len(path) == 1:
+		name := r.URL.Query().Get("names")
+		resources := []map[string]string{}
+		for guid, n := range s.resources[collection] {
+			if n == name {
+				resources = append(resources, map[string]string{"guid": guid, "name": name, "url": s.urls[guid]})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"resources": resources})
+	case r.Method == http.MethodPost && len(path) == 1:
+		name := body["name"].(string)
+		guid := "guid-" + name
+		if s.resources[collection] == nil {
+			s.resources[collection] = map[string]string{}
+		}
+		s.resources[collection][guid] = name
+		if collection == "service_brokers" {
+			s.urls[guid] = body["url"].(string)
+			s.startJob(w, r, guid)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"guid":%q,"name":%q}`, guid, name)
+	case r.Method == http.MethodPatch && len(path) == 2:
+		if collection == "service_brokers" {
+			s.urls[path[1]] = body["url"].(string)
+			s.startJob(w, r, path[1])
+			return
+		}
+		fmt.Fprintf(w, `{"guid":%q}`, path[1])
+	case r.Method == http.MethodDelete && len(path) == 2:
+		if _, ok := s.resources[collection][path[1]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.resources[collection], path[1])
+		s.startJob(w, r, path[1])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *fakeCloudController) recorded() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := s.requests
+	s.requests = nil
+	return result
+}
+
+var _ = Describe("cloud foundry", func() {
+	var controller *fakeCloudController
+	var server *httptest.Server
+	var target CloudFoundryTarget
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		controller = newFakeCloudController()
+		server = httptest.NewServer(controller)
+		Expect(InitTargetFactory(WithHTTPClient(server.Client()), WithJobPollInterval(time.Millisecond))).To(Succeed())
+		target = NewCloudFoundryTarget(&CloudFoundryConfig{
+			CloudFoundryCredentials: Credentials{URL: server.URL, Basic: BasicAuthorization{Username: "admin", Password: "admin-password"}},
+			UAACredentials:          Credentials{URL: server.URL, Basic: BasicAuthorization{Username: "cf"}},
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("creates orgs and assigns the org manager", func() {
+		Expect(target.CreateOrg(ctx, "my-org", "user@example.com")).To(Succeed())
+		Expect(controller.recorded()).To(Equal([]string{
+			"POST /oauth/token",
+			"GET /v3/organizations",
+			"POST /v3/organizations",
+			"POST /v3/roles",
+		}))
+		Expect(controller.resources["organizations"]).To(HaveKeyWithValue("guid-my-org", "my-org"))
+		Expect(controller.roles).To(HaveKey("organization_manager guid-my-org user@example.com"))
+	})
+
+	It("is idempotent if the org and the role exist", func() {
+		Expect(target.CreateOrg(ctx, "my-org", "user@example.com")).To(Succeed())
+		controller.recorded()
+		Expect(target.CreateOrg(ctx, "my-org", "user@example.com")).To(Succeed())
+		Expect(controller.recorded()).To(Equal([]string{
+			"GET /v3/organizations",
+			"POST /v3/roles",
+		}))
+		Expect(controller.tokens).To(Equal(1))
+	})
+
+	It("deletes orgs and waits for the deletion job", func() {
+		Expect(target.CreateOrg(ctx, "my-org", "")).To(Succeed())
+		controller.recorded()
+		Expect(target.DeleteOrg(ctx, "my-org")).To(Succeed())
+		Expect(controller.recorded()).To(Equal([]string{
+			"GET /v3/organizations",
+			"DELETE /v3/organizations/guid-my-org",
+			"GET /v3/jobs/guid-my-org",
+			"GET /v3/jobs/guid-my-org",
+			"GET /v3/organization_quotas",
+		}))
+		Expect(controller.resources["organizations"]).To(BeEmpty())
+	})
+
+	It("ignores missing orgs on deletion", func() {
+		Expect(target.DeleteOrg(ctx, "my-org")).To(Succeed())
+		Expect(controller.recorded()).To(Equal([]string{"POST /oauth/token", "GET /v3/organizations", "GET /v3/organization_quotas"}))
+	})
+
+	It("creates spaces in orgs and assigns roles", func() {
+		Expect(target.CreateOrg(ctx, "my-org", "")).To(Succeed())
+		Expect(target.CreateSpace(ctx, "my-org", "my-space")).To(Succeed())
+		Expect(target.CreateSpace(ctx, "my-org", "my-space")).To(Succeed())
+		Expect(target.AssignSpaceRole(ctx, "my-org", "my-space", "dev@example.com", SpaceDeveloperRole)).To(Succeed())
+		Expect(target.AssignOrgRole(ctx, "my-org", "auditor@example.com", OrganizationAuditorRole)).To(Succeed())
+		Expect(controller.resources["spaces"]).To(Equal(map[string]string{"guid-my-space": "my-space"}))
+		Expect(controller.bodies["POST /v3/spaces"]).To(HaveKeyWithValue("relationships",
+			map[string]interface{}{"organization": map[string]interface{}{"data": map[string]interface{}{"guid": "guid-my-org"}}}))
+		Expect(controller.roles).To(Equal(map[string]bool{
+			"organization_user guid-my-org dev@example.com":        true,
+			"space_developer guid-my-space dev@example.com":        true,
+			"organization_auditor guid-my-org auditor@example.com": true,
+		}))
+		Expect(target.DeleteSpace(ctx, "my-space")).To(Succeed())
+		Expect(controller.resources["spaces"]).To(BeEmpty())
+	})
+
+	It("looks up orgs, spaces and service brokers", func() {
+		exists, err := target.OrgExists(ctx, "my-org")
+		Expect(err).To(Succeed())
+		Expect(exists).To(BeFalse())
+		exists, err = target.SpaceExists(ctx, "my-org", "my-space")
+		Expect(err).To(Succeed())
+		Expect(exists).To(BeFalse())
+		Expect(target.CreateOrg(ctx, "my-org", "")).To(Succeed())
+		Expect(target.CreateSpace(ctx, "my-org", "my-space")).To(Succeed())
+		exists, err = target.OrgExists(ctx, "my-org")
+		Expect(err).To(Succeed())
+		Expect(exists).To(BeTrue())
+		exists, err = target.SpaceExists(ctx, "my-org", "my-space")
+		Expect(err).To(Succeed())
+		Expect(exists).To(BeTrue())
+		url, err := target.ServiceBrokerURL(ctx, "my-broker")
+		Expect(err).To(Succeed())
+		Expect(url).To(BeEmpty())
+		Expect(target.RegisterServiceBroker(ctx, ServiceBroker{Name: "my-broker", URL: "https://broker.example.com"})).To(Succeed())
+		url, err = target.ServiceBrokerURL(ctx, "my-broker")
+		Expect(err).To(Succeed())
+		Expect(url).To(Equal("https://broker.example.com"))
+	})
+
+	It("fails on spaces of missing orgs", func() {
+		Expect(target.CreateSpace(ctx, "my-org", "my-space")).To(MatchError("organization my-org not found"))
+	})
+
+	It("creates and updates quotas", func() {
+		Expect(target.CreateOrg(ctx, "my-org", "")).To(Succeed())
+		Expect(target.CreateSpace(ctx, "my-org", "my-space")).To(Succeed())
+		controller.recorded()
+		Expect(target.SetOrgQuota(ctx, "my-org", CloudFoundryQuota{TotalMemoryInMB: 4096})).To(Succeed())
+		Expect(target.SetOrgQuota(ctx, "my-org", CloudFoundryQuota{TotalMemoryInMB: 8192, TotalRoutes: 10})).To(Succeed())
+		Expect(target.SetSpaceQuota(ctx, "my-org", "my-space", CloudFoundryQuota{TotalServiceInstances: 5})).To(Succeed())
+		Expect(controller.recorded()).To(Equal([]string{
+			"GET /v3/organizations",
+			"GET /v3/organization_quotas",
+			"POST /v3/organization_quotas",
+			"POST /v3/organization_quotas/guid-my-org/relationships/organizations",
+			"GET /v3/organizations",
+			"GET /v3/organization_quotas",
+			"PATCH /v3/organization_quotas/guid-my-org",
+			"POST /v3/organization_quotas/guid-my-org/relationships/organizations",
+			"GET /v3/organizations",
+			"GET /v3/spaces",
+			"GET /v3/space_quotas",
+			"POST /v3/space_quotas",
+			"POST /v3/space_quotas/guid-my-space/relationships/spaces",
+		}))
+		Expect(controller.bodies["PATCH /v3/organization_quotas/guid-my-org"]).To(Equal(map[string]interface{}{
+			"apps":     map[string]interface{}{"total_memory_in_mb": 8192.0},
+			"services": map[string]interface{}{"total_service_instances": nil},
+			"routes":   map[string]interface{}{"total_routes": 10.0},
+		}))
+		Expect(controller.bodies["POST /v3/space_quotas/guid-my-space/relationships/spaces"]).To(Equal(map[string]interface{}{
+			"data": []interface{}{map[string]interface{}{"guid": "guid-my-space"}},
+		}))
+		Expect(target.DeleteOrg(ctx, "my-org")).To(Succeed())
+		Expect(controller.resources["organization_quotas"]).To(BeEmpty())
+	})
+
+	It("registers service brokers and enables their service access", func() {
+		Expect(target.CreateOrg(ctx, "my-org", "")).To(Succeed())
+		broker := ServiceBroker{Name: "my-broker", URL: "https://broker.example.com", Credentials: BasicAuthorization{Username: "broker", Password: "broker-password"}}
+		Expect(target.RegisterServiceBroker(ctx, broker)).To(Succeed())
+		Expect(controller.bodies["POST /v3/service_brokers"]).To(HaveKeyWithValue("authentication", map[string]interface{}{
+			"type":        "basic",
+			"credentials": map[string]interface{}{"username": "broker", "password": "broker-password"},
+		}))
+		broker.URL = "https://broker2.example.com"
+		Expect(target.RegisterServiceBroker(ctx, broker)).To(Succeed())
+		Expect(controller.bodies["PATCH /v3/service_brokers/guid-my-broker"]).To(HaveKeyWithValue("url", "https://broker2.example.com"))
+		controller.recorded()
+		Expect(target.EnableServiceAccess(ctx, "my-broker", []string{"my-org"})).To(Succeed())
+		Expect(target.EnableServiceAccess(ctx, "my-broker", nil)).To(Succeed())
+		Expect(controller.recorded()).To(Equal([]string{
+			"GET /v3/organizations",
+			"GET /v3/service_plans",
+			"POST /v3/service_plans/plan-my-broker/visibility",
+			"GET /v3/service_plans",
+			"PATCH /v3/service_plans/plan-my-broker/visibility",
+		}))
+		Expect(controller.bodies["POST /v3/service_plans/plan-my-broker/visibility"]).To(Equal(map[string]interface{}{
+			"type":          "organization",
+			"organizations": []interface{}{map[string]interface{}{"guid": "guid-my-org"}},
+		}))
+		Expect(target.DeleteServiceBroker(ctx, "my-broker")).To(Succeed())
+		Expect(controller.resources["service_brokers"]).To(BeEmpty())
+	})
+
+	It("registers space scoped service brokers", func() {
+		Expect(target.CreateOrg(ctx, "my-org", "")).To(Succeed())
+		Expect(target.CreateSpace(ctx, "my-org", "my-space")).To(Succeed())
+		broker := ServiceBroker{Name: "my-broker", URL: "https://broker.example.com", Org: "my-org", Space: "my-space"}
+		Expect(target.RegisterServiceBroker(ctx, broker)).To(Succeed())
+		Expect(controller.bodies["POST /v3/service_brokers"]).To(HaveKeyWithValue("relationships",
+			map[string]interface{}{"space": map[string]interface{}{"data": map[string]interface{}{"guid": "guid-my-space"}}}))
+	})
+
+	It("reports failed jobs", func() {
+		Expect(target.CreateOrg(ctx, "undeletable", "")).To(Succeed())
+		err := target.DeleteOrg(ctx, "undeletable")
+		var cfError *CloudFoundryError
+		Expect(errors.As(err, &cfError)).To(BeTrue())
+		Expect(cfError.Errors).To(Equal([]CloudFoundryErrorDetail{{Code: 10008, Title: "CF-UnprocessableEntity", Detail: "org not empty"}}))
+		Expect(IsRetryable(err)).To(BeFalse())
+	})
+
+	It("marks server errors as retryable", func() {
+		controller.failures = 1
+		err := target.CreateOrg(ctx, "my-org", "user@example.com")
+		Expect(IsRetryable(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("failed with status 503: CF-ServiceUnavailable (10015): try again"))
+		Expect(target.CreateOrg(ctx, "my-org", "user@example.com")).To(Succeed())
+	})
+
+	It("fails on invalid credentials", func() {
+		target = NewCloudFoundryTarget(&CloudFoundryConfig{
+			CloudFoundryCredentials: Credentials{URL: server.URL, Basic: BasicAuthorization{Username: "admin", Password: "wrong"}},
+			UAACredentials:          Credentials{URL: server.URL, Basic: BasicAuthorization{Username: "cf"}},
+		})
+		err := target.CreateOrg(ctx, "my-org", "user@example.com")
+		Expect(err).To(MatchError(ContainSubstring("authentication at " + server.URL + " failed")))
+		var cfError *CloudFoundryError
+		Expect(errors.As(err, &cfError)).To(BeTrue())
+		Expect(cfError.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+})
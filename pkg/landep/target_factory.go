@@ -0,0 +1,155 @@
+package landep
+
+import (
+	"net/http"
+	"time"
+)
+
+// TargetFactoryOption configures the targets created after InitTargetFactory
+type TargetFactoryOption = func(f *commandTargetFactory) error
+
+// WithCommandRunner executes the external commands (e.g. helm) with the given runner
+func WithCommandRunner(runner CommandRunner) TargetFactoryOption {
+	return func(f *commandTargetFactory) error {
+		f.runner = runner
+		return nil
+	}
+}
+
+// WithHelmBinary executes the given helm binary instead of the one found in PATH
+func WithHelmBinary(binary string) TargetFactoryOption {
+	return func(f *commandTargetFactory) error {
+		f.helm.binary = binary
+		return nil
+	}
+}
+
+// WithHelmRepository prefixes the chart names, e.g. with a repository name or an oci:// URL
+func WithHelmRepository(repository string) TargetFactoryOption {
+	return func(f *commandTargetFactory) error {
+		f.helm.repository = repository
+		return nil
+	}
+}
+
+// WithKubectlBinary executes the given kubectl binary instead of the one found in PATH
+func WithKubectlBinary(binary string) TargetFactoryOption {
+	return func(f *commandTargetFactory) error {
+		f.kubectl = binary
+		return nil
+	}
+}
+
+// WithKappBinary executes the given kapp binary instead of the one found in PATH
+func WithKappBinary(binary string) TargetFactoryOption {
+	return func(f *commandTargetFactory) error {
+		f.kapp.binary = binary
+		return nil
+	}
+}
+
+// WithYttBinary executes the given ytt binary instead of the one found in PATH
+func WithYttBinary(binary string) TargetFactoryOption {
+	return func(f *commandTargetFactory) error {
+		f.kapp.yttBinary = binary
+		return nil
+	}
+}
+
+// WithKappSources defines the sources of the applications deployed with kapp
+func WithKappSources(sources map[string]KappSource) TargetFactoryOption {
+	return func(f *commandTargetFactory) error {
+		f.kapp.sources = sources
+		return nil
+	}
+}
+
+// WithHTTPClient uses the given client for the requests against cloud foundry
+func WithHTTPClient(client *http.Client) TargetFactoryOption {
+	return func(f *commandTargetFactory) error {
+		f.httpClient = client
+		return nil
+	}
+}
+
+// WithJobPollInterval defines how often asynchronous cloud foundry jobs are polled
+func WithJobPollInterval(interval time.Duration) TargetFactoryOption {
+	return func(f *commandTargetFactory) error {
+		f.jobPollInterval = interval
+		return nil
+	}
+}
+
+// InitTargetFactory creates targets which operate on real clusters using the kubectl, helm, kapp and ytt binaries
+// and on cloud foundry using the cloud controller v3 API.
+func InitTargetFactory(options ...TargetFactoryOption) error {
+	f := &commandTargetFactory{
+		runner:          ExecCommandRunner{},
+		kubectl:         "kubectl",
+		helm:            helmConfig{binary: "helm"},
+		kapp:            kappConfig{binary: "kapp", yttBinary: "ytt"},
+		httpClient:      &http.Client{Timeout: time.Minute},
+		jobPollInterval: time.Second,
+	}
+	for _, o := range options {
+		err := o(f)
+		if err != nil {
+			return err
+		}
+	}
+	tf = f
+	return nil
+}
+
+type commandTargetFactory struct {
+	runner          CommandRunner
+	kubectl         string
+	helm            helmConfig
+	kapp            kappConfig
+	httpClient      *http.Client
+	jobPollInterval time.Duration
+}
+
+func (s *commandTargetFactory) K8s(namespace string, config *K8sConfig) K8sTarget {
+	return &k8sTarget{namespace: namespace, config: config, factory: s}
+}
+
+func (s *commandTargetFactory) CloudFoundry(config *CloudFoundryConfig) CloudFoundryTarget {
+	return &cloudFoundryTarget{config: config, client: s.httpClient, pollInterval: s.jobPollInterval}
+}
+
+func (s *commandTargetFactory) K8sCloudFoundryBridgingTarget(k8s K8sTarget, cf CloudFoundryTarget) K8sCloudFoundryBridgingTarget {
+	return &k8sCloudFoundryBridgingTarget{k8sTarget: k8s, cloudFoundryTarget: cf}
+}
+
+type k8sTarget struct {
+	namespace string
+	config    *K8sConfig
+	factory   *commandTargetFactory
+}
+
+var _ K8sTarget = (*k8sTarget)(nil)
+
+func (s *k8sTarget) Config() *K8sConfig {
+	return s.config
+}
+
+func (s *k8sTarget) Helm() Helm {
+	return &helm{config: s.factory.helm, runner: s.factory.runner, namespace: s.namespace, k8sConfig: s.config, ensureNamespace: s.EnsureNamespace}
+}
+
+func (s *k8sTarget) Kapp() Kapp {
+	return &kapp{config: s.factory.kapp, runner: s.factory.runner, namespace: s.namespace, k8sConfig: s.config, ensureNamespace: s.EnsureNamespace}
+}
+
+func (s *k8sTarget) Manifests() Manifests {
+	return &manifests{kubectl: s.factory.kubectl, runner: s.factory.runner, namespace: s.namespace, kubectlArgs: s.kubectlArgs(), ensureNamespace: s.EnsureNamespace}
+}
+
+func (s *k8sTarget) Description() *TargetDescription {
+	return &TargetDescription{Kind: K8sTargetKind, Namespace: s.namespace, K8sConfig: s.config}
+}
+
+func (s *k8sTarget) Digest() []byte {
+	return k8sTargetDigest(s.namespace, s.config)
+}
@@ -1,37 +1,132 @@
 package landep
 
 import (
-	"crypto/md5"
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 )
 
 func InitFakeTargetFactory(log func(message string)) {
-	tf = &fakeTargetFactory{log: log}
+	tf = &fakeTargetFactory{
+		log: func(ctx context.Context, message string) {
+			log(redactorFrom(ctx).Redact(message))
+		},
+		namespaces:  map[string]bool{},
+		objects:     map[string][]string{},
+		releases:    map[string]*fakeRelease{},
+		apps:        map[string]bool{},
+		cfResources: map[string]string{},
+	}
 }
 
+// fakeNamespaces exist in every cluster and weren't created by landep
+var fakeNamespaces = []string{"default", "kube-node-lease", "kube-public", "kube-system"}
+
 type fakeTargetFactory struct {
-	log func(message string)
+	log func(ctx context.Context, message string)
+	// namespaces contains the namespaces created by EnsureNamespace per cluster
+	namespaces map[string]bool
+	// objects contains the objects applied by Manifests per installation
+	objects map[string][]string
+	// releases contains the helm releases per cluster and namespace
+	releases map[string]*fakeRelease
+	// apps contains the deployed kapp apps per cluster and namespace
+	apps map[string]bool
+	// cfResources maps orgs, spaces and service brokers to their org or URL
+	cfResources map[string]string
+	mutex       sync.Mutex
+}
+
+// fakeRelease keeps chart and values of each revision to support rollbacks
+type fakeRelease struct {
+	revisions []fakeRevision
+}
+
+type fakeRevision struct {
+	ReleaseRevision
+	chart   string
+	version string
+	values  json.RawMessage
+}
+
+func (s *fakeRelease) add(chart string, version string, description string, values json.RawMessage) {
+	for i := range s.revisions {
+		s.revisions[i].Status = ReleaseStatusSuperseded
+	}
+	s.revisions = append(s.revisions, fakeRevision{
+		ReleaseRevision: ReleaseRevision{
+			Revision:    len(s.revisions) + 1,
+			Updated:     time.Now().UTC().Format(time.RFC3339),
+			Status:      ReleaseStatusDeployed,
+			Chart:       chart + "-" + version,
+			Description: description,
+		},
+		chart:   chart,
+		version: version,
+		values:  values,
+	})
+}
+
+func (s *fakeRelease) current() *fakeRevision {
+	return &s.revisions[len(s.revisions)-1]
 }
 
 func (s *fakeTargetFactory) K8sCloudFoundryBridgingTarget(k8s K8sTarget, cf CloudFoundryTarget) K8sCloudFoundryBridgingTarget {
-	return &k8sCloudFoundryBridgingTargetFake{k8sTarget: k8s, cloudFoundryTarget: cf}
+	return &k8sCloudFoundryBridgingTarget{k8sTarget: k8s, cloudFoundryTarget: cf}
 }
 
 func (s *fakeTargetFactory) K8s(namespace string, config *K8sConfig) K8sTarget {
-	return &k8sTargetFake{namespace: namespace, config: config, log: s.log}
+	return &k8sTargetFake{namespace: namespace, config: config, log: s.log, factory: s}
 }
 
 func (s *fakeTargetFactory) CloudFoundry(cfConfig *CloudFoundryConfig) CloudFoundryTarget {
-	return &cloudFoundryTargetFake{config: cfConfig, log: s.log}
+	return &cloudFoundryTargetFake{config: cfConfig, log: s.log, factory: s}
 }
 
 type k8sTargetFake struct {
 	namespace string
 	config    *K8sConfig
-	log       func(message string)
+	log       func(ctx context.Context, message string)
+	factory   *fakeTargetFactory
+}
+
+func (s *k8sTargetFake) EnsureNamespace(ctx context.Context, installation string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, namespace := range fakeNamespaces {
+		if namespace == s.namespace {
+			return nil
+		}
+	}
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	key := s.config.URL + "/" + s.namespace
+	if !s.factory.namespaces[key] {
+		s.factory.namespaces[key] = true
+		s.log(ctx, fmt.Sprintf("kubectl create namespace %s -l %s=%s", s.namespace, installationLabel, installation))
+	}
+	return nil
+}
+
+func (s *k8sTargetFake) DeleteNamespace(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	key := s.config.URL + "/" + s.namespace
+	if s.factory.namespaces[key] {
+		delete(s.factory.namespaces, key)
+		s.log(ctx, fmt.Sprintf("kubectl delete namespace %s", s.namespace))
+	}
+	return nil
 }
 
 func (s *k8sTargetFake) Config() *K8sConfig {
@@ -39,92 +134,407 @@ func (s *k8sTargetFake) Config() *K8sConfig {
 }
 
 type helmFake struct {
-	log       func(message string)
+	log       func(ctx context.Context, message string)
 	namespace string
+	target    *k8sTargetFake
 }
 
-func (s *helmFake) Apply(name string, chart string, version *semver.Version, parameter json.RawMessage) error {
-	s.log(fmt.Sprintf("helm upgrade -i -n %s --version %s %s %s %s", s.namespace, version.String(), name, chart, string(parameter)))
+func (s *helmFake) Apply(ctx context.Context, name string, chart string, version *semver.Version, parameter json.RawMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.target.EnsureNamespace(ctx, name); err != nil {
+		return err
+	}
+	factory := s.target.factory
+	factory.mutex.Lock()
+	defer factory.mutex.Unlock()
+	release, ok := factory.releases[s.key(name)]
+	description := "Upgrade complete"
+	if !ok {
+		release = &fakeRelease{}
+		factory.releases[s.key(name)] = release
+		description = "Install complete"
+	}
+	values := parameter
+	if len(values) == 0 {
+		values = json.RawMessage("{}")
+	}
+	release.add(chart, version.String(), description, values)
+	s.log(ctx, fmt.Sprintf("helm upgrade -i -n %s --version %s %s %s %s", s.namespace, version.String(), name, chart, string(parameter)))
 	return nil
 }
 
-func (s *helmFake) Delete(name string) error {
-	s.log(fmt.Sprintf("helm delete -n %s %s", s.namespace, name))
+func (s *helmFake) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	factory := s.target.factory
+	factory.mutex.Lock()
+	defer factory.mutex.Unlock()
+	delete(factory.releases, s.key(name))
+	s.log(ctx, fmt.Sprintf("helm delete -n %s %s", s.namespace, name))
 	return nil
 }
 
+func (s *helmFake) Status(ctx context.Context, name string) (*ReleaseStatus, error) {
+	var status *ReleaseStatus
+	err := s.withRelease(ctx, name, func(release *fakeRelease) error {
+		current := release.current()
+		status = &ReleaseStatus{
+			Name:         name,
+			Namespace:    s.namespace,
+			Revision:     current.Revision,
+			Status:       current.Status,
+			Chart:        current.chart,
+			ChartVersion: current.version,
+			Description:  current.Description,
+		}
+		return nil
+	})
+	return status, err
+}
+
+func (s *helmFake) GetValues(ctx context.Context, name string) (json.RawMessage, error) {
+	var values json.RawMessage
+	err := s.withRelease(ctx, name, func(release *fakeRelease) error {
+		values = release.current().values
+		return nil
+	})
+	return values, err
+}
+
+func (s *helmFake) History(ctx context.Context, name string) ([]ReleaseRevision, error) {
+	var history []ReleaseRevision
+	err := s.withRelease(ctx, name, func(release *fakeRelease) error {
+		for _, revision := range release.revisions {
+			history = append(history, revision.ReleaseRevision)
+		}
+		return nil
+	})
+	return history, err
+}
+
+func (s *helmFake) Rollback(ctx context.Context, name string, revision int) error {
+	return s.withRelease(ctx, name, func(release *fakeRelease) error {
+		if revision < 1 || revision > len(release.revisions) {
+			return fmt.Errorf("release %s has no revision %d", name, revision)
+		}
+		target := release.revisions[revision-1]
+		release.add(target.chart, target.version, fmt.Sprintf("Rollback to %d", revision), target.values)
+		s.log(ctx, fmt.Sprintf("helm rollback -n %s %s %d", s.namespace, name, revision))
+		return nil
+	})
+}
+
+// withRelease calls f with the state of an applied release while holding the mutex of the factory
+func (s *helmFake) withRelease(ctx context.Context, name string, f func(release *fakeRelease) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	factory := s.target.factory
+	factory.mutex.Lock()
+	defer factory.mutex.Unlock()
+	release, ok := factory.releases[s.key(name)]
+	if !ok {
+		return &ReleaseNotFound{Name: name, Namespace: s.namespace}
+	}
+	return f(release)
+}
+
+func (s *helmFake) key(name string) string {
+	return s.target.config.URL + "/" + s.namespace + "/" + name
+}
+
 type kappFake struct {
-	log       func(message string)
+	log       func(ctx context.Context, message string)
 	namespace string
+	target    *k8sTargetFake
+}
+
+func (s *kappFake) Apply(ctx context.Context, name string, chart string, version *semver.Version, parameter json.RawMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.target.EnsureNamespace(ctx, name); err != nil {
+		return err
+	}
+	factory := s.target.factory
+	factory.mutex.Lock()
+	factory.apps[s.key(name)] = true
+	factory.mutex.Unlock()
+	s.log(ctx, fmt.Sprintf("kapp deploy -n %s -a %s %s %s", s.namespace, name, chart, string(parameter)))
+	return nil
 }
 
-func (s *kappFake) Apply(name string, chart string, version *semver.Version, parameter json.RawMessage) error {
-	s.log(fmt.Sprintf("kapp deploy -n %s -a %s %s %s", s.namespace, name, chart, string(parameter)))
+func (s *kappFake) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	factory := s.target.factory
+	factory.mutex.Lock()
+	delete(factory.apps, s.key(name))
+	factory.mutex.Unlock()
+	s.log(ctx, fmt.Sprintf("kapp delete -n %s -a %s", s.namespace, name))
 	return nil
 }
 
-func (s *kappFake) Delete(name string) error {
-	s.log(fmt.Sprintf("kapp delete -n %s -a %s", s.namespace, name))
+func (s *kappFake) Status(ctx context.Context, name string) (*KappAppStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	factory := s.target.factory
+	factory.mutex.Lock()
+	defer factory.mutex.Unlock()
+	if !factory.apps[s.key(name)] {
+		return nil, &KappAppNotFound{Name: name, Namespace: s.namespace}
+	}
+	return &KappAppStatus{Name: name, Namespace: s.namespace}, nil
+}
+
+func (s *kappFake) key(name string) string {
+	return s.target.config.URL + "/" + s.namespace + "/" + name
+}
+
+type manifestsFake struct {
+	log    func(ctx context.Context, message string)
+	target *k8sTargetFake
+}
+
+func (s *manifestsFake) Apply(ctx context.Context, name string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	manifests, err := parseManifests(data)
+	if err != nil {
+		return err
+	}
+	if err := s.target.EnsureNamespace(ctx, name); err != nil {
+		return err
+	}
+	objects := make([]string, 0, len(manifests))
+	applied := map[string]bool{}
+	for _, manifest := range manifests {
+		objects = append(objects, manifest.String())
+		applied[manifest.String()] = true
+	}
+	factory := s.target.factory
+	factory.mutex.Lock()
+	defer factory.mutex.Unlock()
+	key := s.target.config.URL + "/" + s.target.namespace + "/" + name
+	s.log(ctx, fmt.Sprintf("kubectl apply -n %s -l %s=%s %s", s.target.namespace, installationLabel, name, strings.Join(objects, " ")))
+	for _, object := range factory.objects[key] {
+		if !applied[object] {
+			s.log(ctx, fmt.Sprintf("kubectl delete -n %s %s", s.target.namespace, object))
+		}
+	}
+	factory.objects[key] = objects
 	return nil
 }
 
+func (s *manifestsFake) ApplyKustomization(ctx context.Context, name string, directory string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.target.EnsureNamespace(ctx, name); err != nil {
+		return err
+	}
+	s.log(ctx, fmt.Sprintf("kubectl apply -n %s -l %s=%s -k %s", s.target.namespace, installationLabel, name, directory))
+	return nil
+}
+
+func (s *manifestsFake) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	factory := s.target.factory
+	factory.mutex.Lock()
+	defer factory.mutex.Unlock()
+	delete(factory.objects, s.target.config.URL+"/"+s.target.namespace+"/"+name)
+	s.log(ctx, fmt.Sprintf("kubectl delete -n %s -l %s=%s", s.target.namespace, installationLabel, name))
+	return nil
+}
+
+func (s *k8sTargetFake) Manifests() Manifests {
+	return &manifestsFake{log: s.log, target: s}
+}
+
 func (s *k8sTargetFake) Helm() Helm {
-	return &helmFake{log: s.log, namespace: s.namespace}
+	return &helmFake{log: s.log, namespace: s.namespace, target: s}
 }
 
 func (s *k8sTargetFake) Kapp() Kapp {
-	return &kappFake{log: s.log, namespace: s.namespace}
+	return &kappFake{log: s.log, namespace: s.namespace, target: s}
+}
+
+func (s *k8sTargetFake) Description() *TargetDescription {
+	return &TargetDescription{Kind: K8sTargetKind, Namespace: s.namespace, K8sConfig: s.config}
 }
 
 func (s *k8sTargetFake) Digest() []byte {
-	hash := md5.New()
-	hash.Write([]byte(s.namespace))
-	hash.Write([]byte(s.config.URL))
-	return hash.Sum(nil)
+	return k8sTargetDigest(s.namespace, s.config)
 }
 
 type cloudFoundryTargetFake struct {
-	config *CloudFoundryConfig
-	log    func(message string)
+	config  *CloudFoundryConfig
+	log     func(ctx context.Context, message string)
+	factory *fakeTargetFactory
+}
+
+func (s *cloudFoundryTargetFake) key(kind string, name string) string {
+	return hex.EncodeToString(s.Digest()) + "/" + kind + "/" + name
+}
+
+func (s *cloudFoundryTargetFake) set(kind string, name string, value string) {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	s.factory.cfResources[s.key(kind, name)] = value
+}
+
+func (s *cloudFoundryTargetFake) get(kind string, name string) (string, bool) {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	value, ok := s.factory.cfResources[s.key(kind, name)]
+	return value, ok
 }
 
 func (s *cloudFoundryTargetFake) Config() *CloudFoundryConfig {
 	return s.config
 }
 
+func (s *cloudFoundryTargetFake) Description() *TargetDescription {
+	return &TargetDescription{Kind: CloudFoundryTargetKind, CloudFoundryConfig: s.config}
+}
+
 func (s *cloudFoundryTargetFake) Digest() []byte {
-	hash := md5.New()
-	hash.Write([]byte(s.config.CloudFoundryCredentials.URL))
-	hash.Write([]byte(s.config.UAACredentials.URL))
-	return hash.Sum(nil)
+	return cloudFoundryTargetDigest(s.config)
+}
+
+func (s *cloudFoundryTargetFake) DeleteOrg(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.factory.mutex.Lock()
+	delete(s.factory.cfResources, s.key("org", name))
+	for key, org := range s.factory.cfResources {
+		if org == name && strings.HasPrefix(key, s.key("space", "")) {
+			delete(s.factory.cfResources, key)
+		}
+	}
+	s.factory.mutex.Unlock()
+	s.log(ctx, fmt.Sprintf("cf delete org %s", name))
+	return nil
+}
+
+func (s *cloudFoundryTargetFake) CreateOrg(ctx context.Context, name string, user string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.set("org", name, "")
+	s.log(ctx, fmt.Sprintf("cf create org %s", name))
+	return nil
 }
 
-func (s *cloudFoundryTargetFake) DeleteOrg(name string) error {
-	s.log(fmt.Sprintf("cf delete org %s", name))
+func (s *cloudFoundryTargetFake) CreateSpace(ctx context.Context, org string, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.set("space", name, org)
+	s.log(ctx, fmt.Sprintf("cf create space %s -o %s", name, org))
 	return nil
 }
 
-func (s *cloudFoundryTargetFake) CreateOrg(name string, user string) error {
-	s.log(fmt.Sprintf("cf create org %s", name))
+func (s *cloudFoundryTargetFake) DeleteSpace(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.factory.mutex.Lock()
+	delete(s.factory.cfResources, s.key("space", name))
+	s.factory.mutex.Unlock()
+	s.log(ctx, fmt.Sprintf("cf delete space %s", name))
 	return nil
 }
 
-type k8sCloudFoundryBridgingTargetFake struct {
-	k8sTarget          K8sTarget
-	cloudFoundryTarget CloudFoundryTarget
+func (s *cloudFoundryTargetFake) SetOrgQuota(ctx context.Context, org string, quota CloudFoundryQuota) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.log(ctx, fmt.Sprintf("cf set org quota %s %s", org, quota.String()))
+	return nil
+}
+
+func (s *cloudFoundryTargetFake) SetSpaceQuota(ctx context.Context, org string, space string, quota CloudFoundryQuota) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.log(ctx, fmt.Sprintf("cf set space quota %s -o %s %s", space, org, quota.String()))
+	return nil
+}
+
+func (s *cloudFoundryTargetFake) AssignOrgRole(ctx context.Context, org string, user string, role CloudFoundryRole) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.log(ctx, fmt.Sprintf("cf set org role %s %s %s", user, org, role))
+	return nil
+}
+
+func (s *cloudFoundryTargetFake) AssignSpaceRole(ctx context.Context, org string, space string, user string, role CloudFoundryRole) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.log(ctx, fmt.Sprintf("cf set space role %s %s %s %s", user, org, space, role))
+	return nil
+}
+
+func (s *cloudFoundryTargetFake) RegisterServiceBroker(ctx context.Context, broker ServiceBroker) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.set("broker", broker.Name, broker.URL)
+	s.log(ctx, broker.String())
+	return nil
+}
+
+func (s *cloudFoundryTargetFake) DeleteServiceBroker(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.factory.mutex.Lock()
+	delete(s.factory.cfResources, s.key("broker", name))
+	s.factory.mutex.Unlock()
+	s.log(ctx, fmt.Sprintf("cf delete service broker %s", name))
+	return nil
+}
+
+func (s *cloudFoundryTargetFake) EnableServiceAccess(ctx context.Context, broker string, orgs []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.log(ctx, serviceAccessString(broker, orgs))
+	return nil
 }
 
-func (s k8sCloudFoundryBridgingTargetFake) Digest() []byte {
-	hash := md5.New()
-	hash.Write(s.k8sTarget.Digest())
-	hash.Write(s.cloudFoundryTarget.Digest())
-	return hash.Sum(nil)
+func (s *cloudFoundryTargetFake) OrgExists(ctx context.Context, name string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	_, ok := s.get("org", name)
+	return ok, nil
 }
 
-func (s k8sCloudFoundryBridgingTargetFake) K8sTarget() K8sTarget {
-	return s.k8sTarget
+func (s *cloudFoundryTargetFake) SpaceExists(ctx context.Context, org string, name string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	spaceOrg, ok := s.get("space", name)
+	return ok && spaceOrg == org, nil
 }
 
-func (s k8sCloudFoundryBridgingTargetFake) CloudFoundryTarget() CloudFoundryTarget {
-	return s.cloudFoundryTarget
+func (s *cloudFoundryTargetFake) ServiceBrokerURL(ctx context.Context, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	url, _ := s.get("broker", name)
+	return url, nil
 }
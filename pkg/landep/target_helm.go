@@ -0,0 +1,160 @@
+package landep
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+type helmConfig struct {
+	binary     string
+	repository string
+}
+
+// helm executes the helm binary
+type helm struct {
+	config    helmConfig
+	runner    CommandRunner
+	namespace string
+	k8sConfig *K8sConfig
+	// ensureNamespace is called before each apply
+	ensureNamespace func(ctx context.Context, installation string) error
+}
+
+var _ Helm = (*helm)(nil)
+
+func (s *helm) Apply(ctx context.Context, name string, chart string, version *semver.Version, parameter json.RawMessage) error {
+	if err := s.ensureNamespace(ctx, name); err != nil {
+		return err
+	}
+	if len(parameter) == 0 {
+		parameter = json.RawMessage("{}")
+	}
+	values, err := writeTempFile("landep-values-*.json", parameter)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(values)
+	args := []string{"upgrade", name, s.chart(chart), "--install", "--namespace", s.namespace, "--values", values}
+	if version != nil {
+		args = append(args, "--version", version.String())
+	}
+	_, _, err = s.runner.Run(ctx, s.config.binary, append(args, s.kubeArgs()...)...)
+	return transientCommandError(err)
+}
+
+func (s *helm) Delete(ctx context.Context, name string) error {
+	args := []string{"uninstall", name, "--namespace", s.namespace}
+	_, _, err := s.runner.Run(ctx, s.config.binary, append(args, s.kubeArgs()...)...)
+	if isReleaseNotFound(err) {
+		// already deleted
+		return nil
+	}
+	return transientCommandError(err)
+}
+
+func (s *helm) Status(ctx context.Context, name string) (*ReleaseStatus, error) {
+	var status struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		Version   int    `json:"version"`
+		Info      struct {
+			Status      string `json:"status"`
+			Description string `json:"description"`
+		} `json:"info"`
+		Chart struct {
+			Metadata struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"metadata"`
+		} `json:"chart"`
+	}
+	err := s.query(ctx, name, &status, "status", name)
+	if err != nil {
+		return nil, err
+	}
+	return &ReleaseStatus{
+		Name:         status.Name,
+		Namespace:    status.Namespace,
+		Revision:     status.Version,
+		Status:       status.Info.Status,
+		Chart:        status.Chart.Metadata.Name,
+		ChartVersion: status.Chart.Metadata.Version,
+		Description:  status.Info.Description,
+	}, nil
+}
+
+func (s *helm) GetValues(ctx context.Context, name string) (json.RawMessage, error) {
+	var values json.RawMessage
+	err := s.query(ctx, name, &values, "get", "values", name)
+	if err != nil {
+		return nil, err
+	}
+	if string(values) == "null" {
+		return json.RawMessage("{}"), nil
+	}
+	return values, nil
+}
+
+func (s *helm) History(ctx context.Context, name string) ([]ReleaseRevision, error) {
+	var history []ReleaseRevision
+	err := s.query(ctx, name, &history, "history", name)
+	return history, err
+}
+
+func (s *helm) Rollback(ctx context.Context, name string, revision int) error {
+	args := []string{"rollback", name, strconv.Itoa(revision), "--namespace", s.namespace}
+	_, _, err := s.runner.Run(ctx, s.config.binary, append(args, s.kubeArgs()...)...)
+	if isReleaseNotFound(err) {
+		return &ReleaseNotFound{Name: name, Namespace: s.namespace}
+	}
+	return transientCommandError(err)
+}
+
+// query executes a helm command with JSON output and decodes it into result
+func (s *helm) query(ctx context.Context, name string, result interface{}, args ...string) error {
+	args = append(args, "--namespace", s.namespace, "--output", "json")
+	stdout, _, err := s.runner.Run(ctx, s.config.binary, append(args, s.kubeArgs()...)...)
+	if isReleaseNotFound(err) {
+		return &ReleaseNotFound{Name: name, Namespace: s.namespace}
+	}
+	if err != nil {
+		return transientCommandError(err)
+	}
+	err = json.Unmarshal(stdout, result)
+	if err != nil {
+		return fmt.Errorf("invalid output of helm %s: %v", args[0], err)
+	}
+	return nil
+}
+
+// isReleaseNotFound checks for the error reported by helm for unknown releases. Other errors mentioning
+// "not found" (e.g. an unknown kube context) must not be taken for deleted releases.
+func isReleaseNotFound(err error) bool {
+	var commandError *CommandError
+	return errors.As(err, &commandError) && strings.Contains(commandError.Stderr, "release: not found")
+}
+
+func (s *helm) chart(chart string) string {
+	if s.config.repository == "" {
+		return chart
+	}
+	return strings.TrimSuffix(s.config.repository, "/") + "/" + chart
+}
+
+func (s *helm) kubeArgs() []string {
+	var args []string
+	if s.k8sConfig.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", s.k8sConfig.Kubeconfig)
+	}
+	if s.k8sConfig.Context != "" {
+		args = append(args, "--kube-context", s.k8sConfig.Context)
+	}
+	return args
+}
@@ -0,0 +1,226 @@
+package landep
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeHelm logs its arguments and the content of the values file, prints $FAKE_HELM_STDOUT and fails with $FAKE_HELM_EXIT_CODE
+const fakeHelm = `#!/bin/sh
+echo "$@" >> "$FAKE_LOG_DIR/helm.log"
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--values" ]; then
+    cat "$2" >> "$FAKE_LOG_DIR/helm.log"
+    echo >> "$FAKE_LOG_DIR/helm.log"
+  fi
+  shift
+done
+if [ -n "$FAKE_HELM_STDOUT" ]; then
+  echo "$FAKE_HELM_STDOUT"
+fi
+if [ -n "$FAKE_HELM_STDERR" ]; then
+  echo "$FAKE_HELM_STDERR" >&2
+fi
+exit ${FAKE_HELM_EXIT_CODE:-0}
+`
+
+var _ = Describe("helm", func() {
+	var executables *fakeExecutables
+	ctx := context.Background()
+	version := semver.MustParse("1.7.0")
+
+	helmLog := func() []string {
+		return executables.log("helm")
+	}
+
+	BeforeEach(func() {
+		executables = newFakeExecutables(map[string]string{"helm": fakeHelm, "kubectl": fakeKubectl})
+		Expect(InitTargetFactory()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("FAKE_HELM_EXIT_CODE")
+		os.Unsetenv("FAKE_HELM_STDERR")
+		os.Unsetenv("FAKE_HELM_STDOUT")
+		executables.cleanup()
+	})
+
+	It("upgrades releases with values passed in a file", func() {
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com", Kubeconfig: "/tmp/kubeconfig"})
+		err := target.Helm().Apply(ctx, "release", "istio", version, []byte(`{"pilot":{"instances":3}}`))
+		Expect(err).To(Succeed())
+		log := helmLog()
+		Expect(log).To(HaveLen(2))
+		Expect(log[0]).To(MatchRegexp(`^upgrade release istio --install --namespace istio-system --values \S+landep-values-\d+\.json --version 1\.7\.0 --kubeconfig /tmp/kubeconfig$`))
+		Expect(log[1]).To(Equal(`{"pilot":{"instances":3}}`))
+		values := strings.Fields(log[0])[7]
+		_, err = os.Stat(values)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("prefixes charts with the repository", func() {
+		Expect(InitTargetFactory(WithHelmRepository("oci://registry.example.com/charts/"))).To(Succeed())
+		target := NewK8sTarget("kyma-system", &K8sConfig{URL: "https://cluster.example.com", Context: "dev"})
+		Expect(target.Helm().Apply(ctx, "release", "kyma", version, nil)).To(Succeed())
+		log := helmLog()
+		Expect(log[0]).To(MatchRegexp(`^upgrade release oci://registry.example.com/charts/kyma --install --namespace kyma-system --values \S+ --version 1\.7\.0 --kube-context dev$`))
+		Expect(log[1]).To(Equal(`{}`))
+	})
+
+	It("uninstalls releases", func() {
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com"})
+		Expect(target.Helm().Delete(ctx, "release")).To(Succeed())
+		Expect(helmLog()).To(Equal([]string{"uninstall release --namespace istio-system"}))
+		os.Setenv("FAKE_HELM_EXIT_CODE", "1")
+		os.Setenv("FAKE_HELM_STDERR", "Error: uninstall: Release not loaded: release: not found")
+		Expect(target.Helm().Delete(ctx, "release")).To(Succeed())
+	})
+
+	It("reports failures of uninstalls unrelated to the release", func() {
+		os.Setenv("FAKE_HELM_EXIT_CODE", "1")
+		os.Setenv("FAKE_HELM_STDERR", `Error: kubernetes cluster unreachable: context "x" not found`)
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com", Context: "x"})
+		err := target.Helm().Delete(ctx, "release")
+		var commandError *CommandError
+		Expect(errors.As(err, &commandError)).To(BeTrue())
+		Expect(err.Error()).To(HaveSuffix(`failed (exit code 1): Error: kubernetes cluster unreachable: context "x" not found`))
+		_, err = target.Helm().Status(ctx, "release")
+		Expect(errors.As(err, &commandError)).To(BeTrue())
+	})
+
+	It("reports failures with the output of helm", func() {
+		os.Setenv("FAKE_HELM_EXIT_CODE", "1")
+		os.Setenv("FAKE_HELM_STDERR", "Error: chart not found")
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com"})
+		err := target.Helm().Apply(ctx, "release", "istio", version, nil)
+		var commandError *CommandError
+		Expect(errors.As(err, &commandError)).To(BeTrue())
+		Expect(commandError.ExitCode).To(Equal(1))
+		Expect(commandError.Stderr).To(Equal("Error: chart not found\n"))
+		Expect(err.Error()).To(HavePrefix("helm upgrade release istio"))
+		Expect(err.Error()).To(HaveSuffix("failed (exit code 1): Error: chart not found"))
+		Expect(IsRetryable(err)).To(BeFalse())
+	})
+
+	It("marks transient failures as retryable", func() {
+		os.Setenv("FAKE_HELM_EXIT_CODE", "1")
+		os.Setenv("FAKE_HELM_STDERR", "Error: UPGRADE FAILED: another operation (install/upgrade/rollback) is in progress")
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com"})
+		err := target.Helm().Apply(ctx, "release", "istio", version, nil)
+		Expect(IsRetryable(err)).To(BeTrue())
+	})
+
+	It("returns the status of releases", func() {
+		os.Setenv("FAKE_HELM_STDOUT", `{"name":"release","namespace":"istio-system","version":3,"info":{"status":"failed","description":"Upgrade \"release\" failed: timed out"},"chart":{"metadata":{"name":"istio","version":"1.7.0"}}}`)
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com", Context: "dev"})
+		status, err := target.Helm().Status(ctx, "release")
+		Expect(err).To(Succeed())
+		Expect(status).To(Equal(&ReleaseStatus{
+			Name:         "release",
+			Namespace:    "istio-system",
+			Revision:     3,
+			Status:       ReleaseStatusFailed,
+			Chart:        "istio",
+			ChartVersion: "1.7.0",
+			Description:  `Upgrade "release" failed: timed out`,
+		}))
+		Expect(status.Deployed()).To(BeFalse())
+		Expect(helmLog()).To(Equal([]string{"status release --namespace istio-system --output json --kube-context dev"}))
+	})
+
+	It("returns the values and the history of releases", func() {
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com"})
+		os.Setenv("FAKE_HELM_STDOUT", `{"pilot":{"instances":3}}`)
+		values, err := target.Helm().GetValues(ctx, "release")
+		Expect(err).To(Succeed())
+		Expect(values).To(MatchJSON(`{"pilot":{"instances":3}}`))
+		os.Setenv("FAKE_HELM_STDOUT", "null")
+		values, err = target.Helm().GetValues(ctx, "release")
+		Expect(err).To(Succeed())
+		Expect(values).To(MatchJSON(`{}`))
+		os.Setenv("FAKE_HELM_STDOUT", `[{"revision":1,"updated":"2020-10-01T10:00:00Z","status":"superseded","chart":"istio-1.6.0","app_version":"1.6.0","description":"Install complete"},`+
+			`{"revision":2,"updated":"2020-10-02T10:00:00Z","status":"deployed","chart":"istio-1.7.0","app_version":"1.7.0","description":"Upgrade complete"}]`)
+		history, err := target.Helm().History(ctx, "release")
+		Expect(err).To(Succeed())
+		Expect(history).To(Equal([]ReleaseRevision{
+			{Revision: 1, Updated: "2020-10-01T10:00:00Z", Status: ReleaseStatusSuperseded, Chart: "istio-1.6.0", AppVersion: "1.6.0", Description: "Install complete"},
+			{Revision: 2, Updated: "2020-10-02T10:00:00Z", Status: ReleaseStatusDeployed, Chart: "istio-1.7.0", AppVersion: "1.7.0", Description: "Upgrade complete"},
+		}))
+		Expect(helmLog()).To(Equal([]string{
+			"get values release --namespace istio-system --output json",
+			"get values release --namespace istio-system --output json",
+			"history release --namespace istio-system --output json",
+		}))
+	})
+
+	It("rolls back releases", func() {
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com", Kubeconfig: "/tmp/kubeconfig"})
+		Expect(target.Helm().Rollback(ctx, "release", 2)).To(Succeed())
+		Expect(helmLog()).To(Equal([]string{"rollback release 2 --namespace istio-system --kubeconfig /tmp/kubeconfig"}))
+	})
+
+	It("reports unknown releases", func() {
+		os.Setenv("FAKE_HELM_EXIT_CODE", "1")
+		os.Setenv("FAKE_HELM_STDERR", "Error: release: not found")
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com"})
+		_, err := target.Helm().Status(ctx, "release")
+		Expect(err).To(Equal(&ReleaseNotFound{Name: "release", Namespace: "istio-system"}))
+		_, err = target.Helm().History(ctx, "release")
+		Expect(err).To(Equal(&ReleaseNotFound{Name: "release", Namespace: "istio-system"}))
+		err = target.Helm().Rollback(ctx, "release", 1)
+		Expect(err.Error()).To(Equal("release release not found in namespace istio-system"))
+	})
+
+	It("keeps the releases in the fake", func() {
+		var logs []string
+		InitFakeTargetFactory(func(message string) {
+			logs = append(logs, message)
+		})
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com"})
+		helm := target.Helm()
+		_, err := helm.Status(ctx, "release")
+		Expect(err).To(Equal(&ReleaseNotFound{Name: "release", Namespace: "istio-system"}))
+		Expect(helm.Apply(ctx, "release", "istio", semver.MustParse("1.6.0"), []byte(`{"a":1}`))).To(Succeed())
+		Expect(helm.Apply(ctx, "release", "istio", version, []byte(`{"a":2}`))).To(Succeed())
+		Expect(helm.Rollback(ctx, "release", 1)).To(Succeed())
+		status, err := helm.Status(ctx, "release")
+		Expect(err).To(Succeed())
+		Expect(*status).To(Equal(ReleaseStatus{Name: "release", Namespace: "istio-system", Revision: 3, Status: ReleaseStatusDeployed, Chart: "istio", ChartVersion: "1.6.0", Description: "Rollback to 1"}))
+		values, err := helm.GetValues(ctx, "release")
+		Expect(err).To(Succeed())
+		Expect(values).To(MatchJSON(`{"a":1}`))
+		history, err := helm.History(ctx, "release")
+		Expect(err).To(Succeed())
+		Expect(history).To(HaveLen(3))
+		Expect(history[0].Status).To(Equal(ReleaseStatusSuperseded))
+		Expect(history[1].Chart).To(Equal("istio-1.7.0"))
+		Expect(helm.Rollback(ctx, "release", 4)).To(MatchError("release release has no revision 4"))
+		Expect(helm.Delete(ctx, "release")).To(Succeed())
+		_, err = helm.History(ctx, "release")
+		Expect(err).To(Equal(&ReleaseNotFound{Name: "release", Namespace: "istio-system"}))
+		Expect(logs).To(Equal([]string{
+			"kubectl create namespace istio-system -l landep.io/installation=release",
+			"helm upgrade -i -n istio-system --version 1.6.0 release istio {\"a\":1}",
+			"helm upgrade -i -n istio-system --version 1.7.0 release istio {\"a\":2}",
+			"helm rollback -n istio-system release 1",
+			"helm delete -n istio-system release",
+		}))
+	})
+
+	It("uses an injected command runner", func() {
+		var commands []string
+		Expect(InitTargetFactory(WithHelmBinary("/opt/helm"), WithCommandRunner(CommandRunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+			commands = append(commands, name+" "+strings.Join(args, " "))
+			return nil, nil, nil
+		})))).To(Succeed())
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com"})
+		Expect(target.Helm().Delete(ctx, "release")).To(Succeed())
+		Expect(commands).To(Equal([]string{"/opt/helm uninstall release --namespace istio-system"}))
+	})
+})
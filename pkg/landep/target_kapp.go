@@ -0,0 +1,168 @@
+package landep
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// KappSource is the source of a kapp application. The files in Directory are either deployed
+// as they are or rendered with ytt first. ytt gets the parameter as data values.
+type KappSource struct {
+	Directory string `json:"directory"`
+	Ytt       bool   `json:"ytt,omitempty"`
+}
+
+// LoadKappSources reads a JSON or YAML file mapping application sources (e.g. cf-for-k8s-scp) to KappSources
+func LoadKappSources(path string) (map[string]KappSource, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = YamlToJson(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kapp sources file %s: %v", path, err)
+	}
+	var sources map[string]KappSource
+	err = json.Unmarshal(data, &sources)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kapp sources file %s: %v", path, err)
+	}
+	return sources, nil
+}
+
+// KappDeployError is returned if kapp deploy fails. Diff contains the changes kapp tried to apply.
+type KappDeployError struct {
+	App  string
+	Diff string
+	Err  error
+}
+
+func (d KappDeployError) Error() string {
+	if d.Diff == "" {
+		return fmt.Sprintf("deployment of app %s failed: %v", d.App, d.Err)
+	}
+	return fmt.Sprintf("deployment of app %s failed: %v\n%s", d.App, d.Err, d.Diff)
+}
+
+func (d KappDeployError) Unwrap() error {
+	return d.Err
+}
+
+var _ error = (*KappDeployError)(nil)
+
+type kappConfig struct {
+	binary    string
+	yttBinary string
+	sources   map[string]KappSource
+}
+
+// kapp executes the kapp binary and renders ytt sources with the ytt binary
+type kapp struct {
+	config    kappConfig
+	runner    CommandRunner
+	namespace string
+	k8sConfig *K8sConfig
+	// ensureNamespace is called before each apply
+	ensureNamespace func(ctx context.Context, installation string) error
+}
+
+var _ Kapp = (*kapp)(nil)
+
+func (s *kapp) Apply(ctx context.Context, name string, chart string, version *semver.Version, parameter json.RawMessage) error {
+	source, ok := s.config.sources[chart]
+	if !ok {
+		return fmt.Errorf("no kapp source configured for %s", chart)
+	}
+	if err := s.ensureNamespace(ctx, name); err != nil {
+		return err
+	}
+	files := source.Directory
+	if source.Ytt {
+		rendered, err := s.render(ctx, source, parameter)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(rendered)
+		files = rendered
+	}
+	args := []string{"deploy", "--app", name, "--namespace", s.namespace, "--file", files, "--yes", "--diff-changes"}
+	stdout, _, err := s.runner.Run(ctx, s.config.binary, append(args, s.kubeArgs()...)...)
+	if err != nil {
+		return transientCommandError(&KappDeployError{App: name, Diff: string(stdout), Err: err})
+	}
+	return nil
+}
+
+// render returns a temporary file containing the output of ytt
+func (s *kapp) render(ctx context.Context, source KappSource, parameter json.RawMessage) (string, error) {
+	args := []string{"--file", source.Directory}
+	if len(parameter) != 0 {
+		values, err := writeTempFile("landep-data-values-*.json", parameter)
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(values)
+		args = append(args, "--data-values-file", values)
+	}
+	stdout, _, err := s.runner.Run(ctx, s.config.yttBinary, args...)
+	if err != nil {
+		return "", err
+	}
+	return writeTempFile("landep-rendered-*.yaml", stdout)
+}
+
+func (s *kapp) Delete(ctx context.Context, name string) error {
+	args := []string{"delete", "--app", name, "--namespace", s.namespace, "--yes"}
+	_, _, err := s.runner.Run(ctx, s.config.binary, append(args, s.kubeArgs()...)...)
+	return transientCommandError(err)
+}
+
+func (s *kapp) Status(ctx context.Context, name string) (*KappAppStatus, error) {
+	args := []string{"inspect", "--app", name, "--namespace", s.namespace, "--json"}
+	stdout, _, err := s.runner.Run(ctx, s.config.binary, append(args, s.kubeArgs()...)...)
+	var commandError *CommandError
+	if errors.As(err, &commandError) && strings.Contains(commandError.Stderr, "does not exist") {
+		return nil, &KappAppNotFound{Name: name, Namespace: s.namespace}
+	}
+	if err != nil {
+		return nil, transientCommandError(err)
+	}
+	var output struct {
+		Tables []struct {
+			Rows []map[string]string `json:"Rows"`
+		} `json:"Tables"`
+	}
+	err = json.Unmarshal(stdout, &output)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output of kapp inspect: %v", err)
+	}
+	status := &KappAppStatus{Name: name, Namespace: s.namespace}
+	for _, table := range output.Tables {
+		for _, row := range table.Rows {
+			resource := row["kind"] + "/" + row["name"]
+			status.Resources = append(status.Resources, resource)
+			if state := row["reconcile_state"]; state != "" && state != "ok" {
+				status.Failing = append(status.Failing, resource)
+			}
+		}
+	}
+	return status, nil
+}
+
+func (s *kapp) kubeArgs() []string {
+	var args []string
+	if s.k8sConfig.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", s.k8sConfig.Kubeconfig)
+	}
+	if s.k8sConfig.Context != "" {
+		args = append(args, "--kubeconfig-context", s.k8sConfig.Context)
+	}
+	return args
+}
@@ -0,0 +1,133 @@
+package landep
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeKapp logs its arguments and the content of the deployed file, prints a diff and fails with $FAKE_KAPP_EXIT_CODE.
+// inspect prints $FAKE_KAPP_INSPECT or fails if the app doesn't exist.
+const fakeKapp = `#!/bin/sh
+echo "$@" >> "$FAKE_LOG_DIR/kapp.log"
+if [ "$1" = "inspect" ]; then
+  if [ -z "$FAKE_KAPP_INSPECT" ]; then
+    echo "kapp: Error: App '$3' (namespace: $5) does not exist: configmaps \"$3\" not found" >&2
+    exit 1
+  fi
+  echo "$FAKE_KAPP_INSPECT"
+  exit 0
+fi
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--file" ] && [ -f "$2" ]; then
+    cat "$2" >> "$FAKE_LOG_DIR/kapp.log"
+  fi
+  shift
+done
+echo "@@ create configmap/cf-config (v1) namespace: cf-system @@"
+if [ -n "$FAKE_KAPP_EXIT_CODE" ]; then
+  echo "kapp: Error: Applying create configmap/cf-config (v1) namespace: cf-system: forbidden" >&2
+fi
+exit ${FAKE_KAPP_EXIT_CODE:-0}
+`
+
+// fakeYtt renders the data values file
+const fakeYtt = `#!/bin/sh
+echo "$@" >> "$FAKE_LOG_DIR/ytt.log"
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--data-values-file" ]; then
+    echo "rendered: $(cat "$2")"
+  fi
+  shift
+done
+`
+
+var _ = Describe("kapp", func() {
+	var executables *fakeExecutables
+	var sources string
+	ctx := context.Background()
+	version := semver.MustParse("2.0.0")
+
+	BeforeEach(func() {
+		executables = newFakeExecutables(map[string]string{"kapp": fakeKapp, "ytt": fakeYtt, "kubectl": fakeKubectl})
+		sources = filepath.Join(executables.dir, "sources.yaml")
+		Expect(ioutil.WriteFile(sources, []byte("cf-for-k8s-scp:\n  directory: /sources/cf-for-k8s\n  ytt: true\nplain:\n  directory: /sources/plain\n"), 0600)).To(Succeed())
+		kappSources, err := LoadKappSources(sources)
+		Expect(err).To(Succeed())
+		Expect(InitTargetFactory(WithKappSources(kappSources))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("FAKE_KAPP_EXIT_CODE")
+		os.Unsetenv("FAKE_KAPP_INSPECT")
+		executables.cleanup()
+	})
+
+	It("deploys ytt sources rendered with the parameter as data values", func() {
+		target := NewK8sTarget("cf-system", &K8sConfig{URL: "https://cluster.example.com", Kubeconfig: "/tmp/kubeconfig", Context: "dev"})
+		err := target.Kapp().Apply(ctx, "app", "cf-for-k8s-scp", version, []byte(`{"system_domain":"example.com"}`))
+		Expect(err).To(Succeed())
+		Expect(executables.log("ytt")).To(ConsistOf(MatchRegexp(`^--file /sources/cf-for-k8s --data-values-file \S+landep-data-values-\d+\.json$`)))
+		log := executables.log("kapp")
+		Expect(log).To(HaveLen(2))
+		Expect(log[0]).To(MatchRegexp(`^deploy --app app --namespace cf-system --file \S+landep-rendered-\d+\.yaml --yes --diff-changes --kubeconfig /tmp/kubeconfig --kubeconfig-context dev$`))
+		Expect(log[1]).To(Equal(`rendered: {"system_domain":"example.com"}`))
+		_, err = os.Stat(strings.Fields(log[0])[6])
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("deploys directories", func() {
+		target := NewK8sTarget("default", &K8sConfig{URL: "https://cluster.example.com"})
+		Expect(target.Kapp().Apply(ctx, "app", "plain", version, nil)).To(Succeed())
+		Expect(executables.log("kapp")).To(Equal([]string{"deploy --app app --namespace default --file /sources/plain --yes --diff-changes"}))
+	})
+
+	It("reports unknown sources", func() {
+		target := NewK8sTarget("default", &K8sConfig{URL: "https://cluster.example.com"})
+		err := target.Kapp().Apply(ctx, "app", "unknown", version, nil)
+		Expect(err).To(MatchError("no kapp source configured for unknown"))
+	})
+
+	It("surfaces the diff on failures", func() {
+		os.Setenv("FAKE_KAPP_EXIT_CODE", "1")
+		target := NewK8sTarget("default", &K8sConfig{URL: "https://cluster.example.com"})
+		err := target.Kapp().Apply(ctx, "app", "plain", version, nil)
+		var deployError *KappDeployError
+		Expect(errors.As(err, &deployError)).To(BeTrue())
+		Expect(deployError.Diff).To(ContainSubstring("@@ create configmap/cf-config (v1) namespace: cf-system @@"))
+		Expect(err.Error()).To(ContainSubstring("forbidden"))
+		Expect(err.Error()).To(ContainSubstring("@@ create configmap/cf-config"))
+		var commandError *CommandError
+		Expect(errors.As(err, &commandError)).To(BeTrue())
+		Expect(commandError.ExitCode).To(Equal(1))
+	})
+
+	It("deletes apps", func() {
+		target := NewK8sTarget("cf-system", &K8sConfig{URL: "https://cluster.example.com"})
+		Expect(target.Kapp().Delete(ctx, "app")).To(Succeed())
+		Expect(executables.log("kapp")).To(Equal([]string{"delete --app app --namespace cf-system --yes"}))
+	})
+
+	It("inspects apps", func() {
+		target := NewK8sTarget("cf-system", &K8sConfig{URL: "https://cluster.example.com", Context: "dev"})
+		_, err := target.Kapp().Status(ctx, "app")
+		Expect(err).To(Equal(&KappAppNotFound{Name: "app", Namespace: "cf-system"}))
+		os.Setenv("FAKE_KAPP_INSPECT", `{"Tables":[{"Content":"resources","Rows":[`+
+			`{"age":"1d","kind":"Deployment","name":"capi","namespace":"cf-system","owner":"kapp","reconcile_info":"","reconcile_state":"ok"},`+
+			`{"age":"1d","kind":"Job","name":"migration","namespace":"cf-system","owner":"kapp","reconcile_info":"Failed","reconcile_state":"fail"}]}]}`)
+		status, err := target.Kapp().Status(ctx, "app")
+		Expect(err).To(Succeed())
+		Expect(status).To(Equal(&KappAppStatus{Name: "app", Namespace: "cf-system", Resources: []string{"Deployment/capi", "Job/migration"}, Failing: []string{"Job/migration"}}))
+		Expect(executables.log("kapp")).To(Equal([]string{
+			"inspect --app app --namespace cf-system --json --kubeconfig-context dev",
+			"inspect --app app --namespace cf-system --json --kubeconfig-context dev",
+		}))
+	})
+})
@@ -0,0 +1,137 @@
+package landep
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// manifestKinds are deleted together with the installation. It covers the kinds pruned by kubectl apply.
+const manifestKinds = "all,configmaps,secrets,serviceaccounts,roles,rolebindings,ingresses,networkpolicies,persistentvolumeclaims,poddisruptionbudgets"
+
+// manifest is a kubernetes object
+type manifest map[string]interface{}
+
+// parseManifests splits YAML or JSON documents into objects. Items of lists are returned as separate objects.
+func parseManifests(data []byte) ([]manifest, error) {
+	var manifests []manifest
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var document interface{}
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			return manifests, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid manifests: %v", err)
+		}
+		if document == nil {
+			continue
+		}
+		document, err = jsonCompatible(document)
+		if err != nil {
+			return nil, fmt.Errorf("invalid manifests: %v", err)
+		}
+		object, ok := document.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid manifests: %v is no object", document)
+		}
+		if items, ok := object["items"].([]interface{}); ok && object["kind"] == "List" {
+			for _, item := range items {
+				itemObject, ok := item.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("invalid manifests: %v is no object", item)
+				}
+				manifests = append(manifests, itemObject)
+			}
+			continue
+		}
+		manifests = append(manifests, object)
+	}
+}
+
+// label adds the installation label to the object
+func (s manifest) label(installation string) {
+	metadata, ok := s["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		s["metadata"] = metadata
+	}
+	labels, ok := metadata["labels"].(map[string]interface{})
+	if !ok {
+		labels = map[string]interface{}{}
+		metadata["labels"] = labels
+	}
+	labels[installationLabel] = installation
+}
+
+// String identifies the object as kind/name
+func (s manifest) String() string {
+	name := ""
+	if metadata, ok := s["metadata"].(map[string]interface{}); ok {
+		name, _ = metadata["name"].(string)
+	}
+	return fmt.Sprintf("%v/%s", s["kind"], name)
+}
+
+// manifests applies the objects with kubectl
+type manifests struct {
+	kubectl     string
+	runner      CommandRunner
+	namespace   string
+	kubectlArgs []string
+	// ensureNamespace is called before each apply
+	ensureNamespace func(ctx context.Context, installation string) error
+}
+
+var _ Manifests = (*manifests)(nil)
+
+func (s *manifests) Apply(ctx context.Context, name string, data []byte) error {
+	objects, err := parseManifests(data)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		// kubectl doesn't accept an empty apply, all objects are pruned
+		return s.Delete(ctx, name)
+	}
+	if err := s.ensureNamespace(ctx, name); err != nil {
+		return err
+	}
+	items := make([]interface{}, 0, len(objects))
+	for _, object := range objects {
+		object.label(name)
+		items = append(items, object)
+	}
+	list, err := json.Marshal(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items})
+	if err != nil {
+		return err
+	}
+	file, err := writeTempFile("landep-manifests-*.json", list)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file)
+	args := []string{"apply", "--filename", file, "--namespace", s.namespace, "--prune", "--selector", installationLabel + "=" + name}
+	_, _, err = s.runner.Run(ctx, s.kubectl, append(args, s.kubectlArgs...)...)
+	return transientCommandError(err)
+}
+
+func (s *manifests) ApplyKustomization(ctx context.Context, name string, directory string) error {
+	data, _, err := s.runner.Run(ctx, s.kubectl, "kustomize", directory)
+	if err != nil {
+		return err
+	}
+	return s.Apply(ctx, name, data)
+}
+
+func (s *manifests) Delete(ctx context.Context, name string) error {
+	args := []string{"delete", manifestKinds, "--namespace", s.namespace, "--selector", installationLabel + "=" + name, "--ignore-not-found", "--wait=false"}
+	_, _, err := s.runner.Run(ctx, s.kubectl, append(args, s.kubectlArgs...)...)
+	return transientCommandError(err)
+}
@@ -0,0 +1,99 @@
+package landep
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const testManifests = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  labels:
+    app: app
+`
+
+var _ = Describe("manifests", func() {
+	var executables *fakeExecutables
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		executables = newFakeExecutables(map[string]string{"kubectl": fakeKubectl})
+		Expect(InitTargetFactory()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("FAKE_KUBECTL_STDOUT")
+		executables.cleanup()
+	})
+
+	It("parses YAML documents and lists", func() {
+		objects, err := parseManifests([]byte(testManifests + "---\n" + `{"apiVersion":"v1","kind":"List","items":[{"kind":"Secret","metadata":{"name":"s"}}]}`))
+		Expect(err).To(Succeed())
+		Expect(objects).To(HaveLen(3))
+		Expect(objects[0].String()).To(Equal("ConfigMap/config"))
+		Expect(objects[1].String()).To(Equal("Deployment/app"))
+		Expect(objects[2].String()).To(Equal("Secret/s"))
+		_, err = parseManifests([]byte("- a\n- b\n"))
+		Expect(err).To(MatchError(ContainSubstring("is no object")))
+	})
+
+	It("applies labeled manifests and prunes objects of the installation", func() {
+		target := NewK8sTarget("apps", &K8sConfig{URL: "https://cluster.example.com", Context: "dev"})
+		Expect(target.Manifests().Apply(ctx, "release", []byte(testManifests))).To(Succeed())
+		log := executables.log("kubectl")
+		Expect(log).To(HaveLen(4))
+		Expect(log[0]).To(HavePrefix("create --filename"))
+		Expect(log[2]).To(MatchRegexp(`^apply --filename \S+landep-manifests-\d+\.json --namespace apps --prune --selector landep.io/installation=release --context dev$`))
+		Expect(log[3]).To(MatchJSON(`{"apiVersion":"v1","kind":"List","items":[
+			{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"config","labels":{"landep.io/installation":"release"}},"data":{"key":"value"}},
+			{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"app","labels":{"app":"app","landep.io/installation":"release"}}}]}`))
+	})
+
+	It("applies kustomizations", func() {
+		os.Setenv("FAKE_KUBECTL_STDOUT", testManifests)
+		target := NewK8sTarget("apps", &K8sConfig{URL: "https://cluster.example.com"})
+		Expect(target.Manifests().ApplyKustomization(ctx, "release", "/overlays/dev")).To(Succeed())
+		log := executables.log("kubectl")
+		Expect(log[0]).To(Equal("kustomize /overlays/dev"))
+		Expect(log[3]).To(HavePrefix("apply --filename"))
+		Expect(strings.Count(log[4], "landep.io/installation")).To(Equal(2))
+	})
+
+	It("deletes all objects of the installation", func() {
+		target := NewK8sTarget("apps", &K8sConfig{URL: "https://cluster.example.com"})
+		Expect(target.Manifests().Apply(ctx, "release", nil)).To(Succeed())
+		Expect(target.Manifests().Delete(ctx, "release")).To(Succeed())
+		deletion := "delete " + manifestKinds + " --namespace apps --selector landep.io/installation=release --ignore-not-found --wait=false"
+		Expect(executables.log("kubectl")).To(Equal([]string{deletion, deletion}))
+	})
+
+	It("records the objects in the fake", func() {
+		var logs []string
+		InitFakeTargetFactory(func(message string) {
+			logs = append(logs, message)
+		})
+		target := NewK8sTarget("apps", &K8sConfig{URL: "https://cluster.example.com"})
+		Expect(target.Manifests().Apply(ctx, "release", []byte(testManifests))).To(Succeed())
+		Expect(target.Manifests().Apply(ctx, "release", []byte(strings.Split(testManifests, "---")[1]))).To(Succeed())
+		Expect(target.Manifests().Delete(ctx, "release")).To(Succeed())
+		Expect(logs).To(Equal([]string{
+			"kubectl create namespace apps -l landep.io/installation=release",
+			"kubectl apply -n apps -l landep.io/installation=release ConfigMap/config Deployment/app",
+			"kubectl apply -n apps -l landep.io/installation=release Deployment/app",
+			"kubectl delete -n apps ConfigMap/config",
+			"kubectl delete -n apps -l landep.io/installation=release",
+		}))
+	})
+})
@@ -0,0 +1,65 @@
+package landep
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+const (
+	managedByLabel    = "app.kubernetes.io/managed-by"
+	managedByLandep   = "landep"
+	installationLabel = "landep.io/installation"
+)
+
+// EnsureNamespace creates the namespace with kubectl. Existing namespaces are left untouched, so only
+// namespaces created by landep carry its labels.
+func (s *k8sTarget) EnsureNamespace(ctx context.Context, installation string) error {
+	namespace := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata": map[string]interface{}{
+			"name":   s.namespace,
+			"labels": map[string]string{managedByLabel: managedByLandep, installationLabel: installation},
+		},
+	}
+	data, err := json.Marshal(namespace)
+	if err != nil {
+		return err
+	}
+	manifest, err := writeTempFile("landep-namespace-*.json", data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(manifest)
+	args := []string{"create", "--filename", manifest}
+	_, _, err = s.factory.runner.Run(ctx, s.factory.kubectl, append(args, s.kubectlArgs()...)...)
+	var commandError *CommandError
+	if errors.As(err, &commandError) && strings.Contains(commandError.Stderr, "AlreadyExists") {
+		return nil
+	}
+	return transientCommandError(err)
+}
+
+// DeleteNamespace deletes the namespace if it carries the label of namespaces created by landep
+func (s *k8sTarget) DeleteNamespace(ctx context.Context) error {
+	args := []string{"delete", "namespace",
+		"--selector", managedByLabel + "=" + managedByLandep,
+		"--field-selector", "metadata.name=" + s.namespace,
+		"--wait=false"}
+	_, _, err := s.factory.runner.Run(ctx, s.factory.kubectl, append(args, s.kubectlArgs()...)...)
+	return transientCommandError(err)
+}
+
+func (s *k8sTarget) kubectlArgs() []string {
+	var args []string
+	if s.config.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", s.config.Kubeconfig)
+	}
+	if s.config.Context != "" {
+		args = append(args, "--context", s.config.Context)
+	}
+	return args
+}
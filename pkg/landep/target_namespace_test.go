@@ -0,0 +1,78 @@
+package landep
+
+import (
+	"context"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeKubectl logs its arguments and the content of the manifest, prints $FAKE_KUBECTL_STDOUT and fails with $FAKE_KUBECTL_EXIT_CODE
+const fakeKubectl = `#!/bin/sh
+echo "$@" >> "$FAKE_LOG_DIR/kubectl.log"
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--filename" ]; then
+    cat "$2" >> "$FAKE_LOG_DIR/kubectl.log"
+    echo >> "$FAKE_LOG_DIR/kubectl.log"
+  fi
+  shift
+done
+printf '%s' "$FAKE_KUBECTL_STDOUT"
+if [ -n "$FAKE_KUBECTL_STDERR" ]; then
+  echo "$FAKE_KUBECTL_STDERR" >&2
+fi
+exit ${FAKE_KUBECTL_EXIT_CODE:-0}
+`
+
+var _ = Describe("namespace", func() {
+	var executables *fakeExecutables
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		executables = newFakeExecutables(map[string]string{"kubectl": fakeKubectl, "helm": fakeHelm})
+		Expect(InitTargetFactory()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("FAKE_KUBECTL_EXIT_CODE")
+		os.Unsetenv("FAKE_KUBECTL_STDERR")
+		executables.cleanup()
+	})
+
+	It("creates namespaces labeled with the installation", func() {
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com", Kubeconfig: "/tmp/kubeconfig", Context: "dev"})
+		Expect(target.EnsureNamespace(ctx, "release")).To(Succeed())
+		log := executables.log("kubectl")
+		Expect(log).To(HaveLen(2))
+		Expect(log[0]).To(MatchRegexp(`^create --filename \S+landep-namespace-\d+\.json --kubeconfig /tmp/kubeconfig --context dev$`))
+		Expect(log[1]).To(MatchJSON(`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"istio-system",
+			"labels":{"app.kubernetes.io/managed-by":"landep","landep.io/installation":"release"}}}`))
+	})
+
+	It("leaves existing namespaces untouched", func() {
+		os.Setenv("FAKE_KUBECTL_EXIT_CODE", "1")
+		os.Setenv("FAKE_KUBECTL_STDERR", `Error from server (AlreadyExists): namespaces "default" already exists`)
+		target := NewK8sTarget("default", &K8sConfig{URL: "https://cluster.example.com"})
+		Expect(target.EnsureNamespace(ctx, "release")).To(Succeed())
+		os.Setenv("FAKE_KUBECTL_STDERR", `Error from server (Forbidden): namespaces is forbidden`)
+		Expect(target.EnsureNamespace(ctx, "release")).To(MatchError(ContainSubstring("Forbidden")))
+	})
+
+	It("ensures the namespace before helm applies", func() {
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com"})
+		Expect(target.Helm().Apply(ctx, "release", "istio", nil, nil)).To(Succeed())
+		Expect(executables.log("kubectl")[0]).To(HavePrefix("create --filename"))
+		os.Setenv("FAKE_KUBECTL_EXIT_CODE", "1")
+		Expect(target.Helm().Apply(ctx, "release", "istio", nil, nil)).To(HaveOccurred())
+		Expect(executables.log("helm")).To(HaveLen(2))
+	})
+
+	It("deletes only namespaces created by landep", func() {
+		target := NewK8sTarget("istio-system", &K8sConfig{URL: "https://cluster.example.com"})
+		Expect(target.DeleteNamespace(ctx)).To(Succeed())
+		Expect(executables.log("kubectl")).To(Equal([]string{
+			"delete namespace --selector app.kubernetes.io/managed-by=landep --field-selector metadata.name=istio-system --wait=false",
+		}))
+	})
+})
@@ -0,0 +1,203 @@
+package landep
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// newRecordingTarget wraps a target so that all operations are recorded instead of executed
+func newRecordingTarget(target Target, record func(operation string)) (Target, error) {
+	switch t := target.(type) {
+	case K8sCloudFoundryBridgingTarget:
+		return &k8sCloudFoundryBridgingTargetRecorder{
+			target:             t,
+			k8sTarget:          &k8sTargetRecorder{K8sTarget: t.K8sTarget(), record: record},
+			cloudFoundryTarget: &cloudFoundryTargetRecorder{CloudFoundryTarget: t.CloudFoundryTarget(), record: record},
+		}, nil
+	case K8sTarget:
+		return &k8sTargetRecorder{K8sTarget: t, record: record}, nil
+	case CloudFoundryTarget:
+		return &cloudFoundryTargetRecorder{CloudFoundryTarget: t, record: record}, nil
+	}
+	return nil, fmt.Errorf("target %T can't be recorded", target)
+}
+
+type k8sTargetRecorder struct {
+	K8sTarget
+	record func(operation string)
+}
+
+func (s *k8sTargetRecorder) Helm() Helm {
+	return &helmRecorder{Helm: s.K8sTarget.Helm(), record: s.record, namespace: s.Description().Namespace}
+}
+
+func (s *k8sTargetRecorder) Kapp() Kapp {
+	return &kappRecorder{Kapp: s.K8sTarget.Kapp(), record: s.record, namespace: s.Description().Namespace}
+}
+
+func (s *k8sTargetRecorder) EnsureNamespace(ctx context.Context, installation string) error {
+	s.record(fmt.Sprintf("kubectl create namespace %s -l %s=%s", s.Description().Namespace, installationLabel, installation))
+	return nil
+}
+
+func (s *k8sTargetRecorder) DeleteNamespace(ctx context.Context) error {
+	s.record(fmt.Sprintf("kubectl delete namespace %s", s.Description().Namespace))
+	return nil
+}
+
+func (s *k8sTargetRecorder) Manifests() Manifests {
+	return &manifestsRecorder{record: s.record, namespace: s.Description().Namespace}
+}
+
+type manifestsRecorder struct {
+	record    func(operation string)
+	namespace string
+}
+
+func (s *manifestsRecorder) Apply(ctx context.Context, name string, data []byte) error {
+	manifests, err := parseManifests(data)
+	if err != nil {
+		return err
+	}
+	objects := make([]string, 0, len(manifests))
+	for _, manifest := range manifests {
+		objects = append(objects, manifest.String())
+	}
+	s.record(fmt.Sprintf("kubectl apply -n %s -l %s=%s %s", s.namespace, installationLabel, name, strings.Join(objects, " ")))
+	return nil
+}
+
+func (s *manifestsRecorder) ApplyKustomization(ctx context.Context, name string, directory string) error {
+	s.record(fmt.Sprintf("kubectl apply -n %s -l %s=%s -k %s", s.namespace, installationLabel, name, directory))
+	return nil
+}
+
+func (s *manifestsRecorder) Delete(ctx context.Context, name string) error {
+	s.record(fmt.Sprintf("kubectl delete -n %s -l %s=%s", s.namespace, installationLabel, name))
+	return nil
+}
+
+// helmRecorder executes the queries against the wrapped Helm
+type helmRecorder struct {
+	Helm
+	record    func(operation string)
+	namespace string
+}
+
+func (s *helmRecorder) Apply(ctx context.Context, name string, chart string, version *semver.Version, parameter json.RawMessage) error {
+	s.record(fmt.Sprintf("helm upgrade -i -n %s --version %s %s %s %s", s.namespace, version.String(), name, chart, string(parameter)))
+	return nil
+}
+
+func (s *helmRecorder) Delete(ctx context.Context, name string) error {
+	s.record(fmt.Sprintf("helm delete -n %s %s", s.namespace, name))
+	return nil
+}
+
+func (s *helmRecorder) Rollback(ctx context.Context, name string, revision int) error {
+	s.record(fmt.Sprintf("helm rollback -n %s %s %d", s.namespace, name, revision))
+	return nil
+}
+
+// kappRecorder executes the queries against the wrapped Kapp
+type kappRecorder struct {
+	Kapp
+	record    func(operation string)
+	namespace string
+}
+
+func (s *kappRecorder) Apply(ctx context.Context, name string, chart string, version *semver.Version, parameter json.RawMessage) error {
+	s.record(fmt.Sprintf("kapp deploy -n %s -a %s %s %s", s.namespace, name, chart, string(parameter)))
+	return nil
+}
+
+func (s *kappRecorder) Delete(ctx context.Context, name string) error {
+	s.record(fmt.Sprintf("kapp delete -n %s -a %s", s.namespace, name))
+	return nil
+}
+
+type cloudFoundryTargetRecorder struct {
+	CloudFoundryTarget
+	record func(operation string)
+}
+
+func (s *cloudFoundryTargetRecorder) CreateOrg(ctx context.Context, name string, user string) error {
+	s.record(fmt.Sprintf("cf create org %s", name))
+	return nil
+}
+
+func (s *cloudFoundryTargetRecorder) DeleteOrg(ctx context.Context, name string) error {
+	s.record(fmt.Sprintf("cf delete org %s", name))
+	return nil
+}
+
+func (s *cloudFoundryTargetRecorder) CreateSpace(ctx context.Context, org string, name string) error {
+	s.record(fmt.Sprintf("cf create space %s -o %s", name, org))
+	return nil
+}
+
+func (s *cloudFoundryTargetRecorder) DeleteSpace(ctx context.Context, name string) error {
+	s.record(fmt.Sprintf("cf delete space %s", name))
+	return nil
+}
+
+func (s *cloudFoundryTargetRecorder) SetOrgQuota(ctx context.Context, org string, quota CloudFoundryQuota) error {
+	s.record(fmt.Sprintf("cf set org quota %s %s", org, quota.String()))
+	return nil
+}
+
+func (s *cloudFoundryTargetRecorder) SetSpaceQuota(ctx context.Context, org string, space string, quota CloudFoundryQuota) error {
+	s.record(fmt.Sprintf("cf set space quota %s -o %s %s", space, org, quota.String()))
+	return nil
+}
+
+func (s *cloudFoundryTargetRecorder) AssignOrgRole(ctx context.Context, org string, user string, role CloudFoundryRole) error {
+	s.record(fmt.Sprintf("cf set org role %s %s %s", user, org, role))
+	return nil
+}
+
+func (s *cloudFoundryTargetRecorder) AssignSpaceRole(ctx context.Context, org string, space string, user string, role CloudFoundryRole) error {
+	s.record(fmt.Sprintf("cf set space role %s %s %s %s", user, org, space, role))
+	return nil
+}
+
+func (s *cloudFoundryTargetRecorder) RegisterServiceBroker(ctx context.Context, broker ServiceBroker) error {
+	s.record(broker.String())
+	return nil
+}
+
+func (s *cloudFoundryTargetRecorder) DeleteServiceBroker(ctx context.Context, name string) error {
+	s.record(fmt.Sprintf("cf delete service broker %s", name))
+	return nil
+}
+
+func (s *cloudFoundryTargetRecorder) EnableServiceAccess(ctx context.Context, broker string, orgs []string) error {
+	s.record(serviceAccessString(broker, orgs))
+	return nil
+}
+
+type k8sCloudFoundryBridgingTargetRecorder struct {
+	target             K8sCloudFoundryBridgingTarget
+	k8sTarget          K8sTarget
+	cloudFoundryTarget CloudFoundryTarget
+}
+
+func (s *k8sCloudFoundryBridgingTargetRecorder) Digest() []byte {
+	return s.target.Digest()
+}
+
+func (s *k8sCloudFoundryBridgingTargetRecorder) Description() *TargetDescription {
+	return s.target.Description()
+}
+
+func (s *k8sCloudFoundryBridgingTargetRecorder) K8sTarget() K8sTarget {
+	return s.k8sTarget
+}
+
+func (s *k8sCloudFoundryBridgingTargetRecorder) CloudFoundryTarget() CloudFoundryTarget {
+	return s.cloudFoundryTarget
+}
@@ -0,0 +1,190 @@
+package landep
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// TargetsFile defines named targets, e.g.
+//
+//	targets:
+//	  cluster:
+//	    kind: k8s
+//	    namespace: default
+//	    k8s:
+//	      url: https://cluster.example.com
+//	  cf:
+//	    kind: cloudfoundry
+//	    cloudFoundry:
+//	      cf:
+//	        url: https://api.cf.example.com
+//	        secretRef: CF_CREDENTIALS
+//	      uaa:
+//	        url: https://uaa.cf.example.com
+//	        basic:
+//	          username: admin
+//	          password: secret
+//	  agent:
+//	    kind: k8s-cloudfoundry-bridging
+//	    k8sTarget: cluster
+//	    cloudFoundryTarget: cf
+type TargetsFile struct {
+	Targets map[string]*TargetDefinition `json:"targets"`
+}
+
+// TargetDefinition describes a target. Bridging targets reference a k8s and a cloud foundry target by name.
+type TargetDefinition struct {
+	Kind               string                  `json:"kind"`
+	Namespace          string                  `json:"namespace,omitempty"`
+	K8s                *K8sConfig              `json:"k8s,omitempty"`
+	CloudFoundry       *CloudFoundryDefinition `json:"cloudFoundry,omitempty"`
+	K8sTarget          string                  `json:"k8sTarget,omitempty"`
+	CloudFoundryTarget string                  `json:"cloudFoundryTarget,omitempty"`
+}
+
+// CloudFoundryDefinition is a CloudFoundryConfig whose credentials may reference secrets
+type CloudFoundryDefinition struct {
+	CloudFoundryCredentials CredentialsDefinition `json:"cf"`
+	UAACredentials          CredentialsDefinition `json:"uaa"`
+}
+
+// CredentialsDefinition contains either basic credentials or the name of a secret containing
+// them as JSON object with username and password
+type CredentialsDefinition struct {
+	URL       string              `json:"url"`
+	Basic     *BasicAuthorization `json:"basic,omitempty"`
+	SecretRef string              `json:"secretRef,omitempty"`
+}
+
+// LoadTargetsFile reads a JSON or YAML targets file
+func LoadTargetsFile(path string) (*TargetsFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = YamlToJson(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid targets file %s: %v", path, err)
+	}
+	var targetsFile TargetsFile
+	err = json.Unmarshal(data, &targetsFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid targets file %s: %v", path, err)
+	}
+	return &targetsFile, nil
+}
+
+// Target builds the named target using the target factory. Referenced secrets are resolved with secretResolver.
+func (s *TargetsFile) Target(ctx context.Context, name string, secretResolver SecretResolver) (Target, error) {
+	definition, ok := s.Targets[name]
+	if !ok {
+		return nil, fmt.Errorf("target %s not defined", name)
+	}
+	switch definition.Kind {
+	case K8sTargetKind:
+		if definition.K8s == nil {
+			return nil, fmt.Errorf("target %s of kind %s requires a k8s config", name, definition.Kind)
+		}
+		return NewK8sTarget(definition.Namespace, definition.K8s), nil
+	case CloudFoundryTargetKind:
+		if definition.CloudFoundry == nil {
+			return nil, fmt.Errorf("target %s of kind %s requires a cloud foundry config", name, definition.Kind)
+		}
+		config, err := definition.CloudFoundry.config(ctx, secretResolver)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credentials of target %s: %w", name, err)
+		}
+		return NewCloudFoundryTarget(config), nil
+	case K8sCloudFoundryBridgingTargetKind:
+		k8sTarget, err := s.referencedTarget(ctx, name, definition.K8sTarget, secretResolver)
+		if err != nil {
+			return nil, err
+		}
+		k8s, ok := k8sTarget.(K8sTarget)
+		if !ok {
+			return nil, fmt.Errorf("target %s referenced by %s is no k8s target", definition.K8sTarget, name)
+		}
+		cloudFoundryTarget, err := s.referencedTarget(ctx, name, definition.CloudFoundryTarget, secretResolver)
+		if err != nil {
+			return nil, err
+		}
+		cf, ok := cloudFoundryTarget.(CloudFoundryTarget)
+		if !ok {
+			return nil, fmt.Errorf("target %s referenced by %s is no cloud foundry target", definition.CloudFoundryTarget, name)
+		}
+		return NewK8sCloudFoundryBridgingTarget(k8s, cf), nil
+	}
+	return nil, fmt.Errorf("unknown kind %s of target %s", definition.Kind, name)
+}
+
+func (s *TargetsFile) referencedTarget(ctx context.Context, name string, reference string, secretResolver SecretResolver) (Target, error) {
+	if reference == "" {
+		return nil, fmt.Errorf("target %s of kind %s requires a k8s and a cloud foundry target", name, K8sCloudFoundryBridgingTargetKind)
+	}
+	if definition, ok := s.Targets[reference]; ok && definition.Kind == K8sCloudFoundryBridgingTargetKind {
+		return nil, fmt.Errorf("target %s references bridging target %s", name, reference)
+	}
+	return s.Target(ctx, reference, secretResolver)
+}
+
+func (s *CloudFoundryDefinition) config(ctx context.Context, secretResolver SecretResolver) (*CloudFoundryConfig, error) {
+	cf, err := s.CloudFoundryCredentials.credentials(ctx, secretResolver)
+	if err != nil {
+		return nil, err
+	}
+	uaa, err := s.UAACredentials.credentials(ctx, secretResolver)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudFoundryConfig{CloudFoundryCredentials: cf, UAACredentials: uaa}, nil
+}
+
+func (s *CredentialsDefinition) credentials(ctx context.Context, secretResolver SecretResolver) (Credentials, error) {
+	credentials := Credentials{URL: s.URL, SecretRef: s.SecretRef}
+	if s.SecretRef == "" {
+		if s.Basic != nil {
+			credentials.Basic = *s.Basic
+		}
+		return credentials, nil
+	}
+	if s.Basic != nil {
+		return credentials, fmt.Errorf("credentials of %s contain basic credentials and a secret reference", s.URL)
+	}
+	err := credentials.resolve(ctx, secretResolver)
+	return credentials, err
+}
+
+// resolve reads the basic credentials from the referenced secret, if any
+func (s *Credentials) resolve(ctx context.Context, secretResolver SecretResolver) error {
+	if s.SecretRef == "" {
+		return nil
+	}
+	secret, err := secretResolver.Resolve(ctx, s.SecretRef)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(secret, &s.Basic)
+	if err != nil {
+		return fmt.Errorf("secret %s contains no basic credentials: %v", s.SecretRef, err)
+	}
+	return nil
+}
+
+// resolveCredentials resolves the secrets referenced by the credentials of a description read from the
+// state, which contains only the references
+func (s *TargetDescription) resolveCredentials(ctx context.Context, secretResolver SecretResolver) error {
+	if s == nil || s.CloudFoundryConfig == nil {
+		return nil
+	}
+	err := s.CloudFoundryConfig.CloudFoundryCredentials.resolve(ctx, secretResolver)
+	if err != nil {
+		return fmt.Errorf("invalid credentials of %s: %w", s.CloudFoundryConfig.CloudFoundryCredentials.URL, err)
+	}
+	err = s.CloudFoundryConfig.UAACredentials.resolve(ctx, secretResolver)
+	if err != nil {
+		return fmt.Errorf("invalid credentials of %s: %w", s.CloudFoundryConfig.UAACredentials.URL, err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package landep
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// transaction records the installations created and modified by an apply, so that they can be rolled back
+type transaction struct {
+	mutex    sync.Mutex
+	created  []*Installation
+	modified []*Installation
+	states   map[string]*InstallationState
+}
+
+// create records a newly created installation
+func (t *transaction) create(installation *Installation) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.created = append(t.created, installation)
+}
+
+// modify records the state of an existing installation before it is modified for the first time
+func (t *transaction) modify(installation *Installation) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, created := range t.created {
+		if created == installation {
+			return
+		}
+	}
+	if t.states == nil {
+		t.states = make(map[string]*InstallationState)
+	}
+	if _, ok := t.states[installation.Digest]; ok {
+		return
+	}
+	t.states[installation.Digest] = installation.state()
+	t.modified = append(t.modified, installation)
+}
+
+// RollbackReport lists the installations which were deleted or restored after a failed apply
+type RollbackReport struct {
+	Deleted  []string `json:"deleted,omitempty"`
+	Restored []string `json:"restored,omitempty"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+func (s *RollbackReport) empty() bool {
+	return len(s.Deleted) == 0 && len(s.Restored) == 0 && len(s.Failures) == 0
+}
+
+// ApplyFailed is returned if an apply failed after installations were already created or modified.
+// These installations have been rolled back as described by the report.
+type ApplyFailed struct {
+	Err      error
+	Rollback *RollbackReport
+}
+
+func (s *ApplyFailed) Error() string {
+	var sb strings.Builder
+	sb.WriteString(s.Err.Error())
+	sb.WriteString(" (rollback")
+	if len(s.Rollback.Deleted) != 0 {
+		sb.WriteString(" deleted: ")
+		sb.WriteString(strings.Join(s.Rollback.Deleted, ", "))
+		sb.WriteString(";")
+	}
+	if len(s.Rollback.Restored) != 0 {
+		sb.WriteString(" restored: ")
+		sb.WriteString(strings.Join(s.Rollback.Restored, ", "))
+		sb.WriteString(";")
+	}
+	if len(s.Rollback.Failures) != 0 {
+		sb.WriteString(" failed: ")
+		sb.WriteString(strings.Join(s.Rollback.Failures, ", "))
+		sb.WriteString(";")
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+func (s *ApplyFailed) Unwrap() error {
+	return s.Err
+}
+
+var _ error = (*ApplyFailed)(nil)
+
+func describeInstallation(installation *Installation) string {
+	return fmt.Sprintf("%s:%v on %s", installation.PkgName, installation.Version, installation.Target.Description())
+}
+
+// rollback deletes the installations created by the transaction in reverse order and restores the
+// modified installations to their previous state. err is returned unchanged if nothing had to be rolled back.
+// The rollback isn't bound to the context of the failed apply, which might already be cancelled.
+func (s *PackageManager) rollback(tx *transaction, err error) error {
+	ctx := context.Background()
+	report := &RollbackReport{}
+	for i := len(tx.created) - 1; i >= 0; i-- {
+		installation := tx.created[i]
+		rollbackErr := s.rollbackCreation(ctx, installation)
+		if rollbackErr != nil {
+			report.Failures = append(report.Failures, rollbackErr.Error())
+		} else {
+			report.Deleted = append(report.Deleted, describeInstallation(installation))
+		}
+	}
+	for i := len(tx.modified) - 1; i >= 0; i-- {
+		installation := tx.modified[i]
+		restored, rollbackErr := s.rollbackModification(ctx, installation, tx.states[installation.Digest])
+		if rollbackErr != nil {
+			report.Failures = append(report.Failures, rollbackErr.Error())
+		} else if restored {
+			report.Restored = append(report.Restored, describeInstallation(installation))
+		}
+	}
+	if report.empty() {
+		return err
+	}
+	return &ApplyFailed{Err: err, Rollback: report}
+}
+
+func (s *PackageManager) rollbackCreation(ctx context.Context, installation *Installation) error {
+	unlock := s.lock(installation.Digest)
+	defer unlock()
+	installer, err := s.installedInstaller(installation)
+	if err == nil {
+		err = s.invokeDelete(ctx, installation, installer)
+	}
+	if err != nil {
+		return fmt.Errorf("delete of %s failed: %v", describeInstallation(installation), err)
+	}
+	err = s.forget(installation)
+	if err != nil {
+		return err
+	}
+	return s.releaseNamespace(ctx, installation)
+}
+
+func (s *PackageManager) rollbackModification(ctx context.Context, installation *Installation, state *InstallationState) (bool, error) {
+	unlock := s.lock(installation.Digest)
+	defer unlock()
+	current, err := json.Marshal(installation.state())
+	if err != nil {
+		return false, err
+	}
+	previous, err := json.Marshal(state)
+	if err != nil {
+		return false, err
+	}
+	if JsonEqual(current, previous) {
+		return false, nil
+	}
+	s.mutex.Lock()
+	installations := make(map[string]*Installation, len(s.installationsByDigest))
+	for digest, i := range s.installationsByDigest {
+		installations[digest] = i
+	}
+	s.mutex.Unlock()
+	err = installation.restore(state, installations)
+	if err == nil {
+		var installer Installer
+		installer, err = s.installedInstaller(installation)
+		if err == nil {
+			err = s.run(ctx, installation, installer, nil)
+		}
+	}
+	if err == nil {
+		err = s.save(installation)
+	}
+	if err != nil {
+		return false, fmt.Errorf("restore of %s failed: %v", describeInstallation(installation), err)
+	}
+	return true, nil
+}